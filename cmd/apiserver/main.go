@@ -18,6 +18,8 @@ func init() {
 	flag.StringVar(&configPath, "config-path", "configs/apiserver.toml", "path to config file")
 }
 
+// Without arguments the server is started, otherwise the first argument is a subcommand,
+// e.g. `apiserver -config-path configs/apiserver.toml users import -file users.csv`
 func main() {
 	flag.Parse() // parse all variables defined in init()
 
@@ -27,7 +29,25 @@ func main() {
 		log.Fatal(err)
 	}
 
-	if err := apiserver.Start(config); err != nil {
+	// everything after global flags is a subcommand
+	args := flag.Args()
+	if len(args) == 0 {
+		if err := apiserver.Start(config); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	switch args[0] {
+	case "users":
+		err = runUsers(config, args[1:])
+	case "migrate":
+		err = runMigrate(config, args[1:])
+	default:
+		log.Fatalf("unknown command %q", args[0])
+	}
+
+	if err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/gopherschool/http-rest-api/internal/app/apiserver"
+	"github.com/gopherschool/http-rest-api/internal/app/migrate"
+)
+
+var errMigrateUsage = errors.New("usage: apiserver migrate up|down|status|to N")
+
+// runMigrate handles `apiserver migrate up|down|status|to N`
+func runMigrate(config *apiserver.Config, args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	m, closeDB, err := apiserver.OpenMigrator(config)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	ctx := context.Background()
+	var n int
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		n, err = m.Up(ctx)
+	case args[0] == "down" && len(args) == 1:
+		n, err = m.Down(ctx)
+	case args[0] == "to" && len(args) == 2:
+		target, parseErr := strconv.ParseUint(args[1], 10, 32)
+		if parseErr != nil {
+			return errMigrateUsage
+		}
+
+		n, err = m.To(ctx, uint(target))
+	case args[0] == "status" && len(args) == 1:
+		return printMigrationStatus(ctx, m)
+	default:
+		return errMigrateUsage
+	}
+
+	fmt.Fprintf(os.Stderr, "applied %d migrations\n", n)
+	if err != nil {
+		return err
+	}
+
+	return printVersion(ctx, m)
+}
+
+func printVersion(ctx context.Context, m *migrate.Migrator) error {
+	v, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "schema is at version %d, latest is %d\n", v, m.Latest())
+	return nil
+}
+
+func printMigrationStatus(ctx context.Context, m *migrate.Migrator) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, st := range statuses {
+		state := "pending"
+		if st.Applied {
+			state = "applied"
+		}
+
+		fmt.Printf("%06d_%s\t%s\n", st.Version, st.Name, state)
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gopherschool/http-rest-api/internal/app/apiserver"
+	"github.com/gopherschool/http-rest-api/internal/app/userio"
+)
+
+var errUsersUsage = errors.New("usage: apiserver users import|export [-file path] [-format csv|ndjson] [-batch-size n] [-report path]\n" +
+	"       apiserver users add-cert -email user@example.org -subject dn:CN=name")
+
+// runUsers handles `apiserver users import|export|add-cert`
+func runUsers(config *apiserver.Config, args []string) error {
+	if len(args) == 0 {
+		return errUsersUsage
+	}
+
+	fs := flag.NewFlagSet("users "+args[0], flag.ExitOnError)
+	file := fs.String("file", "", "input/output file, stdin/stdout if empty")
+	format := fs.String("format", "", "csv or ndjson, detected by file extension if empty")
+	batchSize := fs.Int("batch-size", userio.DefaultBatchSize, "number of users per transaction")
+	reportPath := fs.String("report", "", "where to write CSV report with failed rows, stderr if empty")
+	email := fs.String("email", "", "user whose client certificate is added")
+	subject := fs.String("subject", "", "certificate name with its type: dn:DN, dns:NAME, email:ADDRESS or uri:URI")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if *format == "" {
+		*format = formatFromPath(*file)
+	}
+
+	s, closeStore, err := apiserver.OpenStore(config)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	switch args[0] {
+	case "add-cert":
+		if *email == "" || *subject == "" {
+			return errUsersUsage
+		}
+
+		ctx := context.Background()
+		u, err := s.User().FindByEmail(ctx, *email)
+		if err != nil {
+			return fmt.Errorf("user %s: %w", *email, err)
+		}
+
+		if err := s.User().AddCertificateSubject(ctx, u.ID, *subject); err != nil {
+			return fmt.Errorf("subject %s: %w", *subject, err)
+		}
+
+		fmt.Fprintf(os.Stderr, "certificate %q authenticates as %s\n", *subject, u.Email)
+		return nil
+
+	case "import":
+		in := io.Reader(os.Stdin)
+		if *file != "" {
+			f, err := os.Open(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+
+		r, err := userio.NewReader(in, *format)
+		if err != nil {
+			return err
+		}
+
+		report, err := userio.Import(context.Background(), s, r, userio.ImportOptions{BatchSize: *batchSize})
+		if report != nil {
+			fmt.Fprintf(os.Stderr, "imported %d users, %d rows failed\n", report.Imported, len(report.Failed))
+			if len(report.Failed) > 0 {
+				if err := writeReport(*reportPath, report); err != nil {
+					return err
+				}
+			}
+		}
+
+		return err
+
+	case "export":
+		out := io.Writer(os.Stdout)
+		if *file != "" {
+			f, err := os.Create(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+
+		w, err := userio.NewWriter(out, *format)
+		if err != nil {
+			return err
+		}
+
+		n, err := userio.Export(context.Background(), s, w, *batchSize)
+		fmt.Fprintf(os.Stderr, "exported %d users\n", n)
+		return err
+	}
+
+	return errUsersUsage
+}
+
+// formatFromPath guesses format by file extension, CSV is the default one
+func formatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ndjson", ".jsonl":
+		return userio.FormatNDJSON
+	}
+
+	return userio.FormatCSV
+}
+
+func writeReport(path string, report *userio.Report) error {
+	if path == "" {
+		return userio.WriteReport(os.Stderr, report)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return userio.WriteReport(f, report)
+}
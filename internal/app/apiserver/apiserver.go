@@ -1,36 +1,543 @@
 package apiserver
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"errors"
+	"expvar"
+	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/sessions"
+	"github.com/sirupsen/logrus"
 
+	"github.com/gopherschool/http-rest-api/internal/app/blobstore"
+	"github.com/gopherschool/http-rest-api/internal/app/fixtures"
+	"github.com/gopherschool/http-rest-api/internal/app/mailer"
+	"github.com/gopherschool/http-rest-api/internal/app/migrate"
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+	"github.com/gopherschool/http-rest-api/internal/app/store/cachestore"
+	"github.com/gopherschool/http-rest-api/internal/app/store/sqlitestore"
 	"github.com/gopherschool/http-rest-api/internal/app/store/sqlstore"
+	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
+	"github.com/gopherschool/http-rest-api/migrations"
+)
+
+// Values of Config.Store
+const (
+	storePostgres = "postgres"
+	storeMemory   = "memory"
+)
+
+var (
+	// errSQLiteReplicas is returned for config which has both SQLite database and replicas
+	errSQLiteReplicas = errors.New("replica_urls are supported only with postgres")
+	errNoMigrations   = errors.New("memory store has no migrations")
+	errFixtures       = errors.New("fixtures are supported only with memory store")
+	errTLSFiles       = errors.New("both tls_cert_file and tls_key_file must be set")
+	errSettingChanged = errors.New("setting can't be changed after the database was first used")
+
+	// errReplicaCheckInterval is returned for replicas without positive check interval, see openReplicas
+	errReplicaCheckInterval = errors.New("replica_check_interval must be positive")
+	// errExportDir is returned for export_dir which could be served with blob_dir
+	errExportDir = errors.New("export_dir must be set and must not be inside of blob_dir")
 )
 
 func Start(config *Config) error {
-	db, err := newDB(config.DatabaseURL)
+	if config.AutoMigrate && config.Store != storeMemory {
+		if err := migrateUp(config); err != nil {
+			return err
+		}
+	}
+
+	store, schema, closeStore, err := openStore(config)
+	if err != nil {
+		return err
+	}
+
+	defer closeStore()
+	if config.Fixtures != "" {
+		if err := applyFixtures(store, config); err != nil {
+			return err
+		}
+	}
+
+	blobs, err := blobstore.NewLocalStore(config.BlobDir, config.BlobBaseURL)
+	if err != nil {
+		return err
+	}
+
+	exports, err := openExportStore(config)
 	if err != nil {
 		return err
 	}
 
-	defer db.Close()
-	store := sqlstore.NewStore(db)
 	sessionStore := sessions.NewCookieStore([]byte(config.SessionKey))
 	srv := newServer(store, sessionStore)
-	return http.ListenAndServe(config.BindAddr, srv)
+	srv.blobStore = blobs
+	srv.exportStore = exports
+	srv.avatarMaxSize = config.AvatarMaxSize
+	if schema != nil {
+		srv.schema = schema // nil pointer in the interface wouldn't be nil
+	}
+
+	if strings.HasPrefix(config.BlobBaseURL, "/") {
+		srv.serveBlobs(config.BlobBaseURL, blobs)
+	}
+
+	srv.mailer, err = newMailer(config, srv.logger)
+	if err != nil {
+		return err
+	}
+
+	srv.publicURL = strings.TrimSuffix(config.PublicURL, "/")
+	srv.invitationTTL = config.InvitationTTL.Duration
+	// tokens must survive restarts, so the key is derived from the session key instead of being random
+	invitationKey := sha256.Sum256([]byte("invitation:" + config.SessionKey))
+	srv.invitationCodec = newInvitationCodec(invitationKey[:], srv.invitationTTL)
+
+	// signals are subscribed before listening, so an early SIGTERM isn't lost
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	httpServer := newHTTPServer(config, srv)
+	listen := httpServer.ListenAndServe
+	if config.TLSCertFile != "" || config.TLSKeyFile != "" || config.TLSClientCAFile != "" {
+		stopTLS, err := setupTLS(config, httpServer, srv.logger)
+		if err != nil {
+			return err
+		}
+
+		defer stopTLS()
+		listen = func() error { return httpServer.ListenAndServeTLS("", "") }
+	}
+
+	// deferred closing of the store runs only after serve has waited for handlers
+	return srv.serve(httpServer, listen, stop, shutdownOptions{
+		delay:       config.ShutdownDelay.Duration,
+		gracePeriod: config.ShutdownGracePeriod.Duration,
+	})
+}
+
+// setupTLS makes httpServer use certificate from config, starts its reloading and
+// the redirect from plain HTTP. Returned function stops both
+func setupTLS(config *Config, httpServer *http.Server, logger *logrus.Logger) (func(), error) {
+	if config.TLSCertFile == "" || config.TLSKeyFile == "" {
+		return nil, errTLSFiles
+	}
+
+	reloader, err := newCertReloader(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	httpServer.TLSConfig, err = newTLSConfig(config, reloader)
+	if err != nil {
+		return nil, err
+	}
+
+	var redirect *http.Server
+	if config.HTTPRedirectAddr != "" {
+		redirect, err = newRedirectServer(config)
+		if err != nil {
+			return nil, err
+		}
+
+		go func() {
+			if err := redirect.ListenAndServe(); err != http.ErrServerClosed {
+				logger.Errorf("HTTP to HTTPS redirect: %v", err)
+			}
+		}()
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ctx, cancel := context.WithCancel(context.Background())
+	go reloader.watch(ctx, certCheckInterval, hup, logger)
+
+	return func() {
+		signal.Stop(hup)
+		cancel()
+		if redirect != nil {
+			redirect.Close()
+		}
+	}, nil
+}
+
+// OpenStore prepares everything from config that is needed to work with the data
+// and returns the store with a function which releases it. Used both by server and CLI commands.
+// For postgres store scheme of database URL selects the backend: sqlite:// for SQLite file, anything else is postgres
+func OpenStore(config *Config) (store.Store, func(), error) {
+	s, _, closeStore, err := openStore(config)
+	return s, closeStore, err
+}
+
+// openStore is OpenStore which also returns migrator working with connections of the store,
+// the server checks schema version with it. It's nil for memory store
+func openStore(config *Config) (store.Store, *migrate.Migrator, func(), error) {
+	models.SetEmailOptions(models.EmailOptions{ProviderRules: config.EmailProviderRules})
+
+	var openDB func(*Config) (store.Store, *migrate.Migrator, func(), error)
+	switch {
+	case config.Store == storeMemory:
+		// the data is in memory anyway, there is nothing to cache
+		return teststore.NewStore(), nil, func() {}, nil
+	case config.Store != "" && config.Store != storePostgres:
+		return nil, nil, nil, fmt.Errorf("unknown store %q", config.Store)
+	case sqlitestore.IsURL(config.DatabaseURL):
+		openDB = openSQLiteStore
+	default:
+		openDB = openPostgresStore
+	}
+
+	s, m, closeStore, err := openDB(config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := checkSettings(context.Background(), s, config); err != nil {
+		closeStore()
+		return nil, nil, nil, err
+	}
+
+	if config.UserCacheSize <= 0 {
+		return s, m, closeStore, nil
+	}
+
+	cached := cachestore.New(s, cachestore.Options{Size: config.UserCacheSize, TTL: config.UserCacheTTL.Duration})
+	publishCacheStats(cached)
+	return cached, m, closeStore, nil
+}
+
+// settingEmailProviderRules keeps config.EmailProviderRules the database was first used with
+const settingEmailProviderRules = "email_provider_rules"
+
+// checkSettings saves settings from config which must stay the same for the whole life of the database,
+// or compares them with saved ones. Stored emails are normalized with email_provider_rules, with other rules
+// users couldn't be found by their emails and the unique index on emails wouldn't match
+func checkSettings(ctx context.Context, s store.Store, config *Config) error {
+	value := strconv.FormatBool(config.EmailProviderRules)
+	err := s.Setting().Create(ctx, settingEmailProviderRules, value)
+	if err == nil || !errors.Is(err, store.ErrDuplicate) {
+		return err
+	}
+
+	saved, err := s.Setting().Find(ctx, settingEmailProviderRules)
+	if err != nil {
+		return err
+	}
+
+	if saved != value {
+		return fmt.Errorf("%w: database uses %s = %s", errSettingChanged, settingEmailProviderRules, saved)
+	}
+
+	return nil
+}
+
+// openExportStore returns blob store for archives of data exports. They contain personal data,
+// so they are kept apart from uploads which are public
+func openExportStore(config *Config) (*blobstore.LocalStore, error) {
+	if config.ExportDir == "" {
+		return nil, errExportDir
+	}
+
+	blobDir, err := filepath.Abs(config.BlobDir)
+	if err != nil {
+		return nil, err
+	}
+
+	exportDir, err := filepath.Abs(config.ExportDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if rel, err := filepath.Rel(blobDir, exportDir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, errExportDir
+	}
+
+	// there is no URL, archives are streamed by handleDataExportDownload
+	return blobstore.NewLocalStore(config.ExportDir, "")
+}
+
+func openPostgresStore(config *Config) (store.Store, *migrate.Migrator, func(), error) {
+	if len(config.ReplicaURLs) > 0 && config.ReplicaCheckInterval.Duration <= 0 {
+		return nil, nil, nil, errReplicaCheckInterval
+	}
+
+	db, err := newDB(config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, err
+	}
+
+	publishDBStats(db)
+
+	s := sqlstore.NewStore(db)
+	s.SetQueryTimeout(config.QueryTimeout.Duration)
+	if len(config.ReplicaURLs) == 0 {
+		return s, m, func() { db.Close() }, nil
+	}
+
+	closeReplicas, err := openReplicas(s, config)
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, err
+	}
+
+	return s, m, func() {
+		closeReplicas()
+		db.Close()
+	}, nil
+}
+
+func openSQLiteStore(config *Config) (store.Store, *migrate.Migrator, func(), error) {
+	if len(config.ReplicaURLs) > 0 {
+		return nil, nil, nil, errSQLiteReplicas
+	}
+
+	db, err := newSQLiteDB(config.DatabaseURL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	m, err := migrate.New(db, sqlitestore.Migrations())
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, err
+	}
+
+	publishDBStats(db)
+	s := sqlitestore.NewStore(db)
+	s.SetQueryTimeout(config.QueryTimeout.Duration)
+	return s, m.WithoutLock(), func() { db.Close() }, nil
+}
+
+// openReplicas connects store to read replicas and starts their health checks. Unavailable replicas
+// don't prevent start, reads go to the primary until replicas are back
+func openReplicas(s *sqlstore.Store, config *Config) (func(), error) {
+	replicas := make([]*sql.DB, 0, len(config.ReplicaURLs))
+	closeAll := func() {
+		for _, db := range replicas {
+			db.Close()
+		}
+	}
+
+	for _, url := range config.ReplicaURLs {
+		db, err := sql.Open("postgres", url)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+
+		configurePool(db, config)
+		replicas = append(replicas, db)
+	}
+
+	s.SetReplicas(replicas...)
+	interval := config.ReplicaCheckInterval.Duration
+	ctx, cancel := context.WithCancel(context.Background())
+	s.CheckReplicas(ctx, interval)
+	if n := s.HealthyReplicas(); n < len(replicas) {
+		logrus.Warnf("%d of %d replicas are not available, their reads go to the primary", len(replicas)-n, len(replicas))
+	}
+
+	go s.WatchReplicas(ctx, interval)
+	return func() {
+		cancel()
+		closeAll()
+	}, nil
+}
+
+// OpenMigrator connects to the database from config and returns migrator
+// for the embedded migrations with a function which closes the connection
+func OpenMigrator(config *Config) (*migrate.Migrator, func(), error) {
+	if config.Store == storeMemory {
+		return nil, nil, errNoMigrations
+	}
+
+	if sqlitestore.IsURL(config.DatabaseURL) {
+		db, err := newSQLiteDB(config.DatabaseURL)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		m, err := migrate.New(db, sqlitestore.Migrations())
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+
+		return m.WithoutLock(), func() { db.Close() }, nil
+	}
+
+	db, err := newDB(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	return m, func() { db.Close() }, nil
 }
 
-func newDB(databaseURL string) (*sql.DB, error) {
-	db, err := sql.Open("postgres", databaseURL)
+// migrateUp applies pending migrations before server start
+func migrateUp(config *Config) error {
+	m, closeDB, err := OpenMigrator(config)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	n, err := m.Up(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		logrus.Infof("applied %d migrations, schema is at version %d", n, m.Latest())
+	}
+
+	return nil
+}
+
+// applyFixtures seeds the store with fixtures file from config
+func applyFixtures(s store.Store, config *Config) error {
+	if config.Store != storeMemory {
+		return errFixtures
+	}
+
+	f, err := fixtures.Load(config.Fixtures)
+	if err != nil {
+		return err
+	}
+
+	if err := fixtures.Apply(context.Background(), s, f); err != nil {
+		return fmt.Errorf("fixtures: %w", err)
+	}
+
+	logrus.Infof("loaded %d users and %d organizations from %s", len(f.Users), len(f.Organizations), config.Fixtures)
+	return nil
+}
+
+// publishCacheStats makes hit/miss counters of the user cache available through expvar
+func publishCacheStats(s *cachestore.Store) {
+	// OpenStore may be called more than once in one process, but expvar names must be unique
+	if expvar.Get("user_cache") != nil {
+		return
+	}
+
+	expvar.Publish("user_cache", expvar.Func(func() interface{} { return s.Stats() }))
+}
+
+// publishDBStats makes connection pool statistics of the primary database available through expvar
+func publishDBStats(db *sql.DB) {
+	if expvar.Get("db") != nil {
+		return
+	}
+
+	expvar.Publish("db", expvar.Func(func() interface{} { return db.Stats() }))
+}
+
+// newMailer picks mailer implementation from config
+func newMailer(config *Config, logger *logrus.Logger) (mailer.Mailer, error) {
+	switch config.Mailer {
+	case "", "log":
+		return mailer.NewLogMailer(logger), nil
+	case "smtp":
+		return mailer.NewSMTPMailer(config.SMTPAddr, config.SMTPUsername, config.SMTPPassword, config.MailFrom)
+	}
+
+	return nil, fmt.Errorf("unknown mailer %q", config.Mailer)
+}
+
+func newSQLiteDB(databaseURL string) (*sql.DB, error) {
+	db, err := sqlitestore.Open(databaseURL)
 	if err != nil {
 		return nil, err
 	}
 
 	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// newDB opens postgres database from config and waits until it's available, see connect
+func newDB(config *Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", config.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	configurePool(db, config)
+	if err := connect(db, config.ConnectTimeout.Duration); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
+
+func configurePool(db *sql.DB, config *Config) {
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime.Duration)
+	db.SetConnMaxIdleTime(config.ConnMaxIdleTime.Duration)
+}
+
+// Delays between connection attempts of connect, every next delay is twice longer up to the max
+const (
+	connectInitialBackoff = 100 * time.Millisecond
+	connectMaxBackoff     = 5 * time.Second
+)
+
+// connect pings db until it answers or timeout expires. Zero timeout means only one attempt
+func connect(db *sql.DB, timeout time.Duration) error {
+	ctx := context.Background()
+	deadline := time.Now().Add(timeout)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	backoff := connectInitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("database is not available after %d attempts: %w", attempt, err)
+		}
+
+		logrus.Warnf("database is not available, retrying in %s: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > connectMaxBackoff {
+			backoff = connectMaxBackoff
+		}
+	}
+}
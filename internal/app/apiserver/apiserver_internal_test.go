@@ -0,0 +1,135 @@
+package apiserver
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
+)
+
+func TestOpenStore(t *testing.T) {
+	config := NewConfig()
+	config.Store = storeMemory
+	config.Fixtures = filepath.Join("..", "..", "..", "configs", "fixtures.toml")
+	s, closeStore, err := OpenStore(config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer closeStore()
+
+	assert.NoError(t, applyFixtures(s, config))
+	u, err := s.User().FindByEmail(context.Background(), "owner@example.org")
+	assert.NoError(t, err)
+	assert.True(t, u.ComparePasswords("password"))
+
+	_, _, err = OpenMigrator(config)
+	assert.ErrorIs(t, err, errNoMigrations)
+
+	config.Store = "mongo"
+	_, _, err = OpenStore(config)
+	assert.EqualError(t, err, `unknown store "mongo"`)
+
+	// replicas must not be checked with zero timeout, WatchReplicas would panic
+	config.Store = storePostgres
+	config.ReplicaURLs = []string{"postgres://localhost/replica"}
+	config.ReplicaCheckInterval = Duration{}
+	_, _, err = OpenStore(config)
+	assert.ErrorIs(t, err, errReplicaCheckInterval)
+
+	// fixtures would be saved again on every start of a real database
+	config.Store = storePostgres
+	assert.ErrorIs(t, applyFixtures(s, config), errFixtures)
+}
+
+func TestOpenStore_EmailProviderRules(t *testing.T) {
+	config := NewConfig()
+	config.DatabaseURL = "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	m, closeMigrator, err := OpenMigrator(config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = m.Up(context.Background())
+	closeMigrator()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the first use saves the setting, later ones must have the same value
+	for _, rules := range []bool{true, true} {
+		config.EmailProviderRules = rules
+		_, closeStore, err := OpenStore(config)
+		if assert.NoError(t, err) {
+			closeStore()
+		}
+	}
+
+	config.EmailProviderRules = false
+	_, _, err = OpenStore(config)
+	assert.ErrorIs(t, err, errSettingChanged)
+}
+
+func TestOpenExportStore(t *testing.T) {
+	dir := t.TempDir()
+	config := NewConfig()
+	config.BlobDir = filepath.Join(dir, "uploads")
+
+	for _, exportDir := range []string{"", config.BlobDir, filepath.Join(config.BlobDir, "exports")} {
+		config.ExportDir = exportDir
+		_, err := openExportStore(config)
+		assert.ErrorIs(t, err, errExportDir, exportDir)
+	}
+
+	config.ExportDir = filepath.Join(dir, "uploads-exports")
+	_, err := openExportStore(config)
+	assert.NoError(t, err)
+}
+
+func TestConnect(t *testing.T) {
+	// nothing listens on port 1, so every attempt fails at once
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	start := time.Now()
+	err = connect(db, 0)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "after 1 attempts")
+	}
+
+	err = connect(db, 500*time.Millisecond)
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "after 1 attempts")
+	assert.Less(t, int64(time.Since(start)), int64(2*time.Second))
+}
+
+func TestServerHandleDebugVars(t *testing.T) {
+	ctx := context.Background()
+	store := teststore.NewStore()
+	u := models.TestUser(t)
+	store.User().Create(ctx, u)
+	admin := models.TestUser(t)
+	admin.Email = "admin@example.org"
+	admin.IsAdmin = true
+	store.User().Create(ctx, admin)
+
+	secretKey := []byte("secret")
+	s := newServer(store, sessions.NewCookieStore(secretKey))
+	for userID, code := range map[int]int{u.ID: http.StatusForbidden, admin.ID: http.StatusOK} {
+		req, _ := http.NewRequest(http.MethodGet, "/admin/debug/vars", nil)
+		setSession(t, req, secretKey, userID)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		assert.Equal(t, code, rec.Code)
+	}
+}
@@ -1,15 +1,112 @@
 package apiserver
 
+import "time"
+
 type Config struct {
 	BindAddr    string `toml:"bind_addr"` // Address used for web server start
 	LogLevel    string `toml:"log_level"`
 	DatabaseURL string `toml:"database_url"`
+	// HTTPS is served if both TLSCertFile and TLSKeyFile are set. The files are reloaded when they change
+	// or on SIGHUP. If HTTPRedirectAddr is set, plain HTTP on it redirects to HTTPS
+	TLSCertFile      string `toml:"tls_cert_file"`
+	TLSKeyFile       string `toml:"tls_key_file"`
+	TLSMinVersion    string `toml:"tls_min_version"` // "1.2" or "1.3"
+	HTTPRedirectAddr string `toml:"http_redirect_addr"`
+	// If TLSClientCAFile is set, client certificates signed by its CAs are verified and authenticate
+	// users mapped to their subject or SAN. Clients without certificate still use the session cookie
+	TLSClientCAFile string `toml:"tls_client_ca_file"`
+	// Timeouts of http.Server, zero means no timeout. WriteTimeout must be enough for slow downloads
+	ReadHeaderTimeout Duration `toml:"read_header_timeout"`
+	ReadTimeout       Duration `toml:"read_timeout"`
+	WriteTimeout      Duration `toml:"write_timeout"`
+	IdleTimeout       Duration `toml:"idle_timeout"`
+	// On SIGINT or SIGTERM readiness probe fails at once, new connections are accepted for ShutdownDelay more,
+	// then in-flight requests and background jobs get ShutdownGracePeriod to finish
+	ShutdownDelay       Duration `toml:"shutdown_delay"`
+	ShutdownGracePeriod Duration `toml:"shutdown_grace_period"`
+	// Store is "postgres" (data is kept in DatabaseURL, which may also be sqlite://) or "memory"
+	// (data is lost on restart, useful for frontend development without a database)
+	Store string `toml:"store"`
+	// Fixtures is TOML or JSON file with users and organizations saved on start, memory store only
+	Fixtures string `toml:"fixtures"`
+	// Connection pool of postgres database and replicas, zero means no limit.
+	// ConnectTimeout is how long start waits for the database, e.g. while it's starting in the same deployment
+	MaxOpenConns    int      `toml:"max_open_conns"`
+	MaxIdleConns    int      `toml:"max_idle_conns"`
+	ConnMaxLifetime Duration `toml:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `toml:"conn_max_idle_time"`
+	ConnectTimeout  Duration `toml:"connect_timeout"`
+	// ReplicaURLs are read-only replicas of DatabaseURL. Reads go to healthy replicas, except reads
+	// of a request which has already written something
+	ReplicaURLs          []string `toml:"replica_urls"`
+	ReplicaCheckInterval Duration `toml:"replica_check_interval"`
+	// QueryTimeout limits every single database query, requests themselves cancel queries on client disconnect
+	QueryTimeout Duration `toml:"query_timeout"`
+	// UserCacheSize is max number of users cached in memory, zero disables the cache. Cached users are
+	// invalidated by writes of this instance only, others see changes after UserCacheTTL
+	UserCacheSize int      `toml:"user_cache_size"`
+	UserCacheTTL  Duration `toml:"user_cache_ttl"`
+	// AutoMigrate applies pending migrations on Start, otherwise run `apiserver migrate up`
+	AutoMigrate bool   `toml:"auto_migrate"`
 	SessionKey  string `toml:"session_key"`
+	// EmailProviderRules enables provider specific email normalization (gmail dots, "+tags"), see models.NormalizeEmail
+	EmailProviderRules bool `toml:"email_provider_rules"`
+	// Uploaded files (avatars) are kept in BlobDir. If BlobBaseURL is a path, server serves them itself,
+	// otherwise it's expected that BlobDir is available by this URL somewhere else (e.g. nginx or CDN)
+	BlobDir       string `toml:"blob_dir"`
+	BlobBaseURL   string `toml:"blob_base_url"`
+	AvatarMaxSize int64  `toml:"avatar_max_size"` // in bytes
+	// Archives of personal data exports are kept in ExportDir. It must not be inside of BlobDir
+	// and must never be served, archives are downloaded only by their owners through the API
+	ExportDir string `toml:"export_dir"`
+	// PublicURL is where clients reach the server, used for links in emails
+	PublicURL     string   `toml:"public_url"`
+	InvitationTTL Duration `toml:"invitation_ttl"`
+	// Mailer is either "log" (emails are only written to log) or "smtp"
+	Mailer       string `toml:"mailer"`
+	MailFrom     string `toml:"mail_from"`
+	SMTPAddr     string `toml:"smtp_addr"` // host:port
+	SMTPUsername string `toml:"smtp_username"`
+	SMTPPassword string `toml:"smtp_password"`
 }
 
 func NewConfig() *Config {
 	return &Config{
-		BindAddr: ":8080",
-		LogLevel: "debug",
+		BindAddr:             ":8080",
+		LogLevel:             "debug",
+		Store:                storePostgres,
+		TLSMinVersion:        "1.2",
+		ReadHeaderTimeout:    Duration{5 * time.Second},
+		ReadTimeout:          Duration{30 * time.Second},
+		WriteTimeout:         Duration{60 * time.Second},
+		IdleTimeout:          Duration{2 * time.Minute},
+		ShutdownGracePeriod:  Duration{30 * time.Second},
+		MaxOpenConns:         25,
+		MaxIdleConns:         25,
+		ConnMaxLifetime:      Duration{30 * time.Minute},
+		ConnMaxIdleTime:      Duration{5 * time.Minute},
+		ConnectTimeout:       Duration{30 * time.Second},
+		QueryTimeout:         Duration{5 * time.Second},
+		ReplicaCheckInterval: Duration{5 * time.Second},
+		UserCacheTTL:         Duration{30 * time.Second},
+		BlobDir:              "uploads",
+		BlobBaseURL:          "/uploads",
+		ExportDir:            "exports",
+		AvatarMaxSize:        defaultAvatarMaxSize,
+		PublicURL:            "http://localhost:8080",
+		InvitationTTL:        Duration{defaultInvitationTTL},
+		Mailer:               "log",
+		MailFrom:             "noreply@localhost",
 	}
 }
+
+// Duration can be written in TOML as a string like "72h" or "1m30s"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
@@ -0,0 +1,112 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Build information, set at link time, see Makefile:
+// go build -ldflags "-X github.com/gopherschool/http-rest-api/internal/app/apiserver.version=v1.2.0"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+var errDraining = errors.New("server is shutting down")
+
+// readyTimeout limits checks of readiness probe, orchestrators usually wait for a second or so
+const readyTimeout = 2 * time.Second
+
+// quietPaths are requested by orchestrator every few seconds, logging them would drown everything else
+var quietPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// schemaVersioner is implemented by *migrate.Migrator
+type schemaVersioner interface {
+	AppliedVersion(ctx context.Context) (uint, error)
+	Latest() uint
+}
+
+// handleHealthz tells that the process is alive and serves requests, nothing else is checked
+func (s *server) handleHealthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.respond(w, r, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// handleReadyz tells whether the server should get traffic: it's not shutting down,
+// the database is reachable and has the schema this binary expects.
+// The probe needs no authentication, so the reason is only logged: errors of the database must not leak
+func (s *server) handleReadyz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.checkReady(r.Context()); err != nil {
+			s.logger.Warnf("not ready: %v", err)
+			s.respond(w, r, http.StatusServiceUnavailable, map[string]string{"status": "unavailable"})
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+func (s *server) checkReady(ctx context.Context) error {
+	if s.isDraining() {
+		return errDraining
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	if err := s.store.Ping(ctx); err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+
+	// memory store has no schema
+	if s.schema == nil {
+		return nil
+	}
+
+	current, err := s.schema.AppliedVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("schema version: %w", err)
+	}
+
+	if current != s.schema.Latest() {
+		return fmt.Errorf("schema is at version %d, expected %d", current, s.schema.Latest())
+	}
+
+	return nil
+}
+
+// setDraining makes readiness probe fail, so orchestrator stops sending new requests
+func (s *server) setDraining() {
+	atomic.StoreInt32(&s.draining, 1)
+}
+
+func (s *server) isDraining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// handleVersion renders build information
+func (s *server) handleVersion() http.HandlerFunc {
+	type response struct {
+		Version   string `json:"version"`
+		Commit    string `json:"commit"`
+		BuildTime string `json:"build_time"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.respond(w, r, http.StatusOK, &response{
+			Version:   version,
+			Commit:    commit,
+			BuildTime: buildTime,
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package apiserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
+)
+
+// fakeSchema reports fixed versions of schema
+type fakeSchema struct {
+	current, latest uint
+}
+
+func (f *fakeSchema) AppliedVersion(ctx context.Context) (uint, error) {
+	return f.current, nil
+}
+
+func (f *fakeSchema) Latest() uint {
+	return f.latest
+}
+
+func TestServerHandleHealth(t *testing.T) {
+	s := newServer(teststore.NewStore(), sessions.NewCookieStore([]byte("secret")))
+	logs := &bytes.Buffer{}
+	s.logger.Out = logs
+	do := func(url string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, do("/healthz").Code)
+	assert.Equal(t, http.StatusOK, do("/readyz").Code)
+
+	s.schema = &fakeSchema{current: 7, latest: 8}
+	rec := do("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.JSONEq(t, `{"status": "unavailable"}`, rec.Body.String())
+	assert.Contains(t, logs.String(), "schema is at version 7, expected 8")
+
+	s.schema = &fakeSchema{current: 8, latest: 8}
+	assert.Equal(t, http.StatusOK, do("/readyz").Code)
+
+	// draining server is still alive, but must not get new requests
+	s.setDraining()
+	assert.Equal(t, http.StatusServiceUnavailable, do("/readyz").Code)
+	assert.Equal(t, http.StatusOK, do("/healthz").Code)
+
+	rec = do("/version")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	info := map[string]string{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&info))
+	assert.Equal(t, "dev", info["version"])
+}
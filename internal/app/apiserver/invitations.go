@@ -0,0 +1,258 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/securecookie"
+
+	"github.com/gopherschool/http-rest-api/internal/app/mailer"
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// defaultInvitationTTL is how long invitation can be accepted if nothing else is configured
+const defaultInvitationTTL = 7 * 24 * time.Hour
+
+// invitationTokenName is a "name" for securecookie, tokens encoded with another name are not accepted
+const invitationTokenName = "invitation"
+
+var (
+	errInvalidInvitation  = errors.New("invitation is invalid")
+	errInvitationInactive = errors.New("invitation is expired or already accepted")
+	errAlreadyMember      = errors.New("user is already a member of organization")
+	errInvitationEmail    = errors.New("invitation was sent to another email")
+	errLoginRequired      = errors.New("account with this email already exists, log in to accept invitation")
+	errInvitationConflict = errors.New("invitation can't be created for this organization")
+)
+
+// newInvitationCodec returns codec which signs invitation tokens.
+// Tokens contain only invitation ID, they can't be changed without the key and are rejected after maxAge
+func newInvitationCodec(hashKey []byte, maxAge time.Duration) *securecookie.SecureCookie {
+	return securecookie.New(hashKey, nil).MaxAge(int(maxAge.Seconds()))
+}
+
+// handleInvitationsCreate invites person by email to organization from X-Org-ID.
+// Only owners and admins can invite, invitation link is sent by mailer
+func (s *server) handleInvitationsCreate() http.HandlerFunc {
+	type request struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := r.Context().Value(ctxKeyMembership).(*models.Membership)
+		if !current.CanManageMembers() {
+			s.error(w, r, http.StatusForbidden, errForbidden)
+			return
+		}
+
+		req := &request{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if req.Role == "" {
+			req.Role = models.RoleMember
+		}
+
+		// there is no point to invite existing members
+		if u, err := s.store.User().FindByEmail(r.Context(), req.Email); err == nil {
+			if _, err := s.store.Membership().Find(r.Context(), current.OrganizationID, u.ID); err == nil {
+				s.error(w, r, http.StatusConflict, errAlreadyMember)
+				return
+			}
+		}
+
+		inv := &models.Invitation{
+			OrganizationID: current.OrganizationID,
+			Email:          req.Email,
+			Role:           req.Role,
+			InvitedBy:      current.UserID,
+			ExpiresAt:      time.Now().Add(s.invitationTTL),
+		}
+		o := r.Context().Value(ctxKeyOrganization).(*models.Organization)
+		// the email is sent before commit, so invitation isn't saved if it can't be sent.
+		// No retries, sent email can't be taken back
+		if err := s.store.WithTx(r.Context(), &store.TxOptions{}, func(tx store.Store) error {
+			if err := tx.Invitation().Create(r.Context(), inv); err != nil {
+				return err
+			}
+
+			token, err := s.invitationCodec.Encode(invitationTokenName, inv.ID)
+			if err != nil {
+				return err
+			}
+
+			return s.mailer.Send(mailer.Message{
+				To:      inv.Email,
+				Subject: fmt.Sprintf("You are invited to %s", o.Name),
+				Body: fmt.Sprintf(
+					"You were invited to join %s as %s.\n\nOpen the link to accept the invitation: %s/invitations/%s\n\nThe link is valid until %s.\n",
+					o.Name, inv.Role, s.publicURL, token, inv.ExpiresAt.Format(time.RFC1123),
+				),
+			})
+		}); err != nil {
+			var validationErrs validation.Errors
+			switch {
+			case errors.As(err, &validationErrs):
+				s.error(w, r, http.StatusUnprocessableEntity, err)
+			case errors.Is(err, store.ErrDuplicate), errors.Is(err, store.ErrConflict):
+				// organization or inviting user was deleted meanwhile, no details from DB
+				s.error(w, r, http.StatusConflict, errInvitationConflict)
+			default:
+				s.error(w, r, http.StatusInternalServerError, err)
+			}
+			return
+		}
+
+		s.respond(w, r, http.StatusCreated, inv)
+	}
+}
+
+// handleInvitationsPreview is available without authentication, so the invited person
+// can see where they are invited before signing up
+func (s *server) handleInvitationsPreview() http.HandlerFunc {
+	type response struct {
+		Organization *models.Organization `json:"organization"`
+		Email        string               `json:"email"`
+		Role         string               `json:"role"`
+		ExpiresAt    time.Time            `json:"expires_at"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		inv := r.Context().Value(ctxKeyInvitation).(*models.Invitation)
+		o, err := s.store.Organization().FindByID(r.Context(), inv.OrganizationID)
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, &response{
+			Organization: o,
+			Email:        inv.Email,
+			Role:         inv.Role,
+			ExpiresAt:    inv.ExpiresAt,
+		})
+	}
+}
+
+// handleInvitationsAccept attaches user to organization. Logged in user must have the invited email.
+// Without session a new account is created with the invited email and password from request,
+// and the new user is logged in right away
+func (s *server) handleInvitationsAccept() http.HandlerFunc {
+	type request struct {
+		Password string `json:"password"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		inv := r.Context().Value(ctxKeyInvitation).(*models.Invitation)
+
+		u, err := s.sessionUser(r)
+		if err != nil && err != errNotAuthenticated {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		if u != nil && models.NormalizeEmail(u.Email) != inv.Email {
+			s.error(w, r, http.StatusForbidden, errInvitationEmail)
+			return
+		}
+
+		if u == nil {
+			// password is needed only for new accounts
+			req := &request{}
+			if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+				s.error(w, r, http.StatusBadRequest, err)
+				return
+			}
+
+			if _, err := s.store.User().FindByEmail(r.Context(), inv.Email); err == nil {
+				s.error(w, r, http.StatusConflict, errLoginRequired)
+				return
+			}
+
+			u = &models.User{Email: inv.Email, Password: req.Password}
+			if err := u.Validate(); err != nil {
+				s.error(w, r, http.StatusUnprocessableEntity, err)
+				return
+			}
+		}
+
+		// user, membership and accepted flag are saved together or not saved at all.
+		// Transaction may be retried, and u.ID is already set after a failed attempt
+		isNew := u.ID == 0
+		if err := s.store.WithTx(r.Context(), nil, func(tx store.Store) error {
+			if err := tx.Invitation().MarkAccepted(r.Context(), inv); err != nil {
+				return err
+			}
+
+			if isNew {
+				if err := tx.User().Create(r.Context(), u); err != nil {
+					return err
+				}
+			}
+
+			return tx.Membership().Create(r.Context(), &models.Membership{
+				OrganizationID: inv.OrganizationID,
+				UserID:         u.ID,
+				Role:           inv.Role,
+			})
+		}); err != nil {
+			switch {
+			case errors.Is(err, store.ErrConflict):
+				// somebody has accepted it in parallel
+				s.error(w, r, http.StatusGone, errInvitationInactive)
+			case errors.Is(err, store.ErrDuplicate):
+				s.error(w, r, http.StatusConflict, errAlreadyMember)
+			default:
+				s.error(w, r, http.StatusInternalServerError, err)
+			}
+			return
+		}
+
+		if err := s.startSession(w, r, u); err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		u.Sanitize()
+		s.respond(w, r, http.StatusOK, u)
+	}
+}
+
+// resolveInvitation decodes invitation token from URL and attaches active invitation to the context
+func (s *server) resolveInvitation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var id int
+		if err := s.invitationCodec.Decode(invitationTokenName, mux.Vars(r)["token"], &id); err != nil {
+			s.error(w, r, http.StatusNotFound, errInvalidInvitation)
+			return
+		}
+
+		inv, err := s.store.Invitation().FindByID(r.Context(), id)
+		if err != nil {
+			if err == store.ErrRecordNotFound {
+				s.error(w, r, http.StatusNotFound, errInvalidInvitation)
+				return
+			}
+
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !inv.IsActive(time.Now()) {
+			s.error(w, r, http.StatusGone, errInvitationInactive)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyInvitation, inv)))
+	})
+}
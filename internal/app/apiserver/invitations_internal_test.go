@@ -0,0 +1,183 @@
+package apiserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/mailer"
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
+)
+
+// testMailer keeps sent messages in memory. Messages are not sent if err is set
+type testMailer struct {
+	messages []mailer.Message
+	err      error
+}
+
+func (m *testMailer) Send(msg mailer.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var invitationLinkRegexp = regexp.MustCompile(`/invitations/(\S+)`)
+
+func TestServerInvitations(t *testing.T) {
+	ctx := context.Background()
+	store := teststore.NewStore()
+	owner := models.TestUser(t)
+	owner.Email = "owner@example.org"
+	store.User().Create(ctx, owner)
+	existing := models.TestUser(t)
+	existing.Email = "existing@example.org"
+	store.User().Create(ctx, existing)
+	o := &models.Organization{Name: "Acme"}
+	store.Organization().Create(ctx, o)
+	store.Membership().Create(ctx, &models.Membership{OrganizationID: o.ID, UserID: owner.ID, Role: models.RoleOwner})
+
+	secretKey := []byte("secret")
+	s := newServer(store, sessions.NewCookieStore(secretKey))
+	m := &testMailer{}
+	s.mailer = m
+
+	// do sends request, userID == 0 means anonymous request
+	do := func(userID int, method, url string, payload interface{}) *httptest.ResponseRecorder {
+		b := &bytes.Buffer{}
+		if payload != nil {
+			json.NewEncoder(b).Encode(payload)
+		}
+
+		req, _ := http.NewRequest(method, url, b)
+		if userID != 0 {
+			setSession(t, req, secretKey, userID)
+		}
+		req.Header.Set(orgIDHeader, strconv.Itoa(o.ID))
+
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// invite sends invitation on behalf of owner and returns token from the email
+	invite := func(email string) string {
+		rec := do(owner.ID, http.MethodPost, "/private/invitations", map[string]string{"email": email})
+		if !assert.Equal(t, http.StatusCreated, rec.Code) {
+			return ""
+		}
+
+		msg := m.messages[len(m.messages)-1]
+		assert.Equal(t, email, msg.To)
+		match := invitationLinkRegexp.FindStringSubmatch(msg.Body)
+		if !assert.Len(t, match, 2) {
+			return ""
+		}
+
+		return match[1]
+	}
+
+	t.Run("new user", func(t *testing.T) {
+		token := invite("new@example.org")
+
+		rec := do(0, http.MethodGet, "/invitations/"+token, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Acme")
+
+		rec = do(0, http.MethodPost, "/invitations/"+token+"/accept", map[string]string{"password": "123"})
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		rec = do(0, http.MethodPost, "/invitations/"+token+"/accept", map[string]string{"password": "password"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("Set-Cookie")) // new user is logged in
+
+		u, err := store.User().FindByEmail(ctx, "new@example.org")
+		assert.NoError(t, err)
+		mm, err := store.Membership().Find(ctx, o.ID, u.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.RoleMember, mm.Role)
+
+		// invitation can be used only once
+		rec = do(0, http.MethodPost, "/invitations/"+token+"/accept", map[string]string{"password": "password"})
+		assert.Equal(t, http.StatusGone, rec.Code)
+
+		// already a member
+		rec = do(owner.ID, http.MethodPost, "/private/invitations", map[string]string{"email": "new@example.org"})
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("existing user", func(t *testing.T) {
+		token := invite("existing@example.org")
+
+		rec := do(0, http.MethodPost, "/invitations/"+token+"/accept", map[string]string{"password": "password"})
+		assert.Equal(t, http.StatusConflict, rec.Code)
+
+		rec = do(owner.ID, http.MethodPost, "/invitations/"+token+"/accept", nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		rec = do(existing.ID, http.MethodPost, "/invitations/"+token+"/accept", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		_, err := store.Membership().Find(ctx, o.ID, existing.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid and expired tokens", func(t *testing.T) {
+		rec := do(0, http.MethodGet, "/invitations/garbage", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		inv := &models.Invitation{
+			OrganizationID: o.ID,
+			Email:          "late@example.org",
+			Role:           models.RoleMember,
+			InvitedBy:      owner.ID,
+			ExpiresAt:      time.Now().Add(-time.Minute),
+		}
+		assert.NoError(t, store.Invitation().Create(ctx, inv))
+		token, _ := s.invitationCodec.Encode(invitationTokenName, inv.ID)
+		rec = do(0, http.MethodGet, "/invitations/"+token, nil)
+		assert.Equal(t, http.StatusGone, rec.Code)
+	})
+
+	t.Run("members can't invite", func(t *testing.T) {
+		member := models.TestUser(t)
+		member.Email = "member@example.org"
+		store.User().Create(ctx, member)
+		store.Membership().Create(ctx, &models.Membership{OrganizationID: o.ID, UserID: member.ID, Role: models.RoleMember})
+
+		rec := do(member.ID, http.MethodPost, "/private/invitations", map[string]string{"email": "friend@example.org"})
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("invalid invitation", func(t *testing.T) {
+		rec := do(owner.ID, http.MethodPost, "/private/invitations", map[string]string{"email": "invalid"})
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		rec = do(owner.ID, http.MethodPost, "/private/invitations", map[string]string{"email": "friend@example.org", "role": models.RoleOwner})
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
+	t.Run("email not sent", func(t *testing.T) {
+		m.err = errors.New("smtp is down")
+		defer func() { m.err = nil }()
+
+		rec := do(owner.ID, http.MethodPost, "/private/invitations", map[string]string{"email": "unsent@example.org"})
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+		invitations, err := store.Invitation().ListByEmail(ctx, "unsent@example.org")
+		assert.NoError(t, err)
+		assert.Empty(t, invitations)
+	})
+}
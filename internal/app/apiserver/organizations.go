@@ -0,0 +1,219 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// orgIDHeader selects organization for organization scoped endpoints
+const orgIDHeader = "X-Org-ID"
+
+var (
+	errInvalidOrgID     = errors.New("missing or invalid " + orgIDHeader + " header")
+	errNotMember        = errors.New("not a member of organization")
+	errOwnerRequired    = errors.New("only owners can change owners")
+	errLastOwner        = errors.New("organization must have at least one owner")
+	errMemberIDRequired = errors.New("invalid member id")
+)
+
+// resolveOrganization must go after authenticateUser. It finds organization from X-Org-ID header
+// and membership of the current user in it. Both are attached to the request context
+func (s *server) resolveOrganization(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgID, err := strconv.Atoi(r.Header.Get(orgIDHeader))
+		if err != nil || orgID <= 0 {
+			s.error(w, r, http.StatusBadRequest, errInvalidOrgID)
+			return
+		}
+
+		u := r.Context().Value(ctxKeyUser).(*models.User)
+		// membership is checked first, so outsiders can't find out which organizations exist
+		m, err := s.store.Membership().Find(r.Context(), orgID, u.ID)
+		if err != nil {
+			if err == store.ErrRecordNotFound {
+				s.error(w, r, http.StatusForbidden, errNotMember)
+				return
+			}
+
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		o, err := s.store.Organization().FindByID(r.Context(), orgID)
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ctxKeyOrganization, o)
+		ctx = context.WithValue(ctx, ctxKeyMembership, m)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// handleOrganizationsCreate creates organization, current user becomes its owner
+func (s *server) handleOrganizationsCreate() http.HandlerFunc {
+	type request struct {
+		Name string `json:"name"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &request{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		u := r.Context().Value(ctxKeyUser).(*models.User)
+		o := &models.Organization{Name: req.Name}
+		if err := o.Validate(); err != nil {
+			s.error(w, r, http.StatusUnprocessableEntity, err)
+			return
+		}
+
+		// organization without owner is useless, so both are created in one transaction
+		if err := s.store.WithTx(r.Context(), nil, func(tx store.Store) error {
+			if err := tx.Organization().Create(r.Context(), o); err != nil {
+				return err
+			}
+
+			return tx.Membership().Create(r.Context(), &models.Membership{
+				OrganizationID: o.ID,
+				UserID:         u.ID,
+				Role:           models.RoleOwner,
+			})
+		}); err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.respond(w, r, http.StatusCreated, o)
+	}
+}
+
+// handleMembersList renders all members of organization from X-Org-ID
+func (s *server) handleMembersList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		o := r.Context().Value(ctxKeyOrganization).(*models.Organization)
+		members, err := s.store.Membership().ListByOrganization(r.Context(), o.ID)
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, members)
+	}
+}
+
+// handleMembersUpdate changes role of a member. Owners and admins can manage members,
+// but only owners can make somebody an owner or change role of another owner
+func (s *server) handleMembersUpdate() http.HandlerFunc {
+	type request struct {
+		Role string `json:"role"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := r.Context().Value(ctxKeyMembership).(*models.Membership)
+		if !current.CanManageMembers() {
+			s.error(w, r, http.StatusForbidden, errForbidden)
+			return
+		}
+
+		userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, errMemberIDRequired)
+			return
+		}
+
+		req := &request{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := (&models.Membership{Role: req.Role}).Validate(); err != nil {
+			s.error(w, r, http.StatusUnprocessableEntity, err)
+			return
+		}
+
+		// owners are counted in the same serializable transaction as the role is changed,
+		// so two owners demoting each other concurrently can't leave organization without owners
+		var m *models.Membership
+		if err := s.store.WithTx(r.Context(), &store.TxOptions{
+			Isolation:  store.IsolationSerializable,
+			MaxRetries: store.DefaultTxMaxRetries,
+		}, func(tx store.Store) error {
+			// role of the caller could be changed since the request was authorized
+			caller, err := tx.Membership().Find(r.Context(), current.OrganizationID, current.UserID)
+			if err == store.ErrRecordNotFound || err == nil && !caller.CanManageMembers() {
+				return errForbidden
+			}
+
+			if err != nil {
+				return err
+			}
+
+			m, err = tx.Membership().Find(r.Context(), current.OrganizationID, userID)
+			if err != nil {
+				return err
+			}
+
+			if (m.Role == models.RoleOwner || req.Role == models.RoleOwner) && caller.Role != models.RoleOwner {
+				return errOwnerRequired
+			}
+
+			if m.Role == models.RoleOwner && req.Role != models.RoleOwner {
+				if err := checkNotLastOwner(r.Context(), tx, m.OrganizationID); err != nil {
+					return err
+				}
+			}
+
+			m.Role = req.Role
+			return tx.Membership().UpdateRole(r.Context(), m)
+		}); err != nil {
+			switch err {
+			case store.ErrRecordNotFound:
+				s.error(w, r, http.StatusNotFound, err)
+			case errForbidden, errOwnerRequired:
+				s.error(w, r, http.StatusForbidden, err)
+			case errLastOwner:
+				s.error(w, r, http.StatusConflict, err)
+			default:
+				s.error(w, r, http.StatusInternalServerError, err)
+			}
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, m)
+	}
+}
+
+// checkNotLastOwner returns errLastOwner if organization has only one owner.
+// It must be called in the transaction which changes the owner
+func checkNotLastOwner(ctx context.Context, tx store.Store, organizationID int) error {
+	members, err := tx.Membership().ListByOrganization(ctx, organizationID)
+	if err != nil {
+		return err
+	}
+
+	owners := 0
+	for _, m := range members {
+		if m.Role == models.RoleOwner {
+			owners++
+		}
+	}
+
+	if owners <= 1 {
+		return errLastOwner
+	}
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package apiserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
+)
+
+func TestServerOrganizations(t *testing.T) {
+	ctx := context.Background()
+	store := teststore.NewStore()
+	users := map[string]*models.User{}
+	for _, name := range []string{"owner", "admin", "member", "outsider"} {
+		u := models.TestUser(t)
+		u.Email = name + "@example.org"
+		assert.NoError(t, store.User().Create(ctx, u))
+		users[name] = u
+	}
+
+	secretKey := []byte("secret")
+	s := newServer(store, sessions.NewCookieStore(secretKey))
+
+	// do sends request on behalf of user with optional X-Org-ID header
+	do := func(user string, method, url string, orgID int, payload interface{}) *httptest.ResponseRecorder {
+		b := &bytes.Buffer{}
+		if payload != nil {
+			json.NewEncoder(b).Encode(payload)
+		}
+
+		req, _ := http.NewRequest(method, url, b)
+		setSession(t, req, secretKey, users[user].ID)
+		if orgID != 0 {
+			req.Header.Set(orgIDHeader, strconv.Itoa(orgID))
+		}
+
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("owner", http.MethodPost, "/private/orgs", 0, map[string]string{"name": "Acme"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	o := &models.Organization{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(o))
+
+	rec = do("owner", http.MethodPost, "/private/orgs", 0, map[string]string{"name": ""})
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	store.Membership().Create(ctx, &models.Membership{OrganizationID: o.ID, UserID: users["admin"].ID, Role: models.RoleAdmin})
+	store.Membership().Create(ctx, &models.Membership{OrganizationID: o.ID, UserID: users["member"].ID, Role: models.RoleMember})
+
+	testCases := []struct {
+		name         string
+		user         string
+		method       string
+		url          string
+		orgID        int
+		payload      interface{}
+		expectedCode int
+	}{
+		{
+			name:         "list members",
+			user:         "member",
+			method:       http.MethodGet,
+			url:          "/private/org/members",
+			orgID:        o.ID,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "missing org header",
+			user:         "member",
+			method:       http.MethodGet,
+			url:          "/private/org/members",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not a member",
+			user:         "outsider",
+			method:       http.MethodGet,
+			url:          "/private/org/members",
+			orgID:        o.ID,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "member can't change roles",
+			user:         "member",
+			method:       http.MethodPatch,
+			url:          fmt.Sprintf("/private/org/members/%d", users["member"].ID),
+			orgID:        o.ID,
+			payload:      map[string]string{"role": models.RoleAdmin},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "admin promotes member",
+			user:         "admin",
+			method:       http.MethodPatch,
+			url:          fmt.Sprintf("/private/org/members/%d", users["member"].ID),
+			orgID:        o.ID,
+			payload:      map[string]string{"role": models.RoleAdmin},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "admin can't make owners",
+			user:         "admin",
+			method:       http.MethodPatch,
+			url:          fmt.Sprintf("/private/org/members/%d", users["member"].ID),
+			orgID:        o.ID,
+			payload:      map[string]string{"role": models.RoleOwner},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "invalid role",
+			user:         "owner",
+			method:       http.MethodPatch,
+			url:          fmt.Sprintf("/private/org/members/%d", users["member"].ID),
+			orgID:        o.ID,
+			payload:      map[string]string{"role": "superuser"},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "last owner can't step down",
+			user:         "owner",
+			method:       http.MethodPatch,
+			url:          fmt.Sprintf("/private/org/members/%d", users["owner"].ID),
+			orgID:        o.ID,
+			payload:      map[string]string{"role": models.RoleMember},
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:         "unknown member",
+			user:         "owner",
+			method:       http.MethodPatch,
+			url:          fmt.Sprintf("/private/org/members/%d", users["outsider"].ID),
+			orgID:        o.ID,
+			payload:      map[string]string{"role": models.RoleMember},
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := do(tc.user, tc.method, tc.url, tc.orgID, tc.payload)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+		})
+	}
+
+	m, err := store.Membership().Find(ctx, o.ID, users["member"].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, m.Role)
+
+	// two owners demote each other at once, one of them must stay
+	rec = do("owner", http.MethodPatch, fmt.Sprintf("/private/org/members/%d", users["admin"].ID), o.ID, map[string]string{"role": models.RoleOwner})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i, pair := range [][2]string{{"owner", "admin"}, {"admin", "owner"}} {
+		wg.Add(1)
+		go func(i int, user, target string) {
+			defer wg.Done()
+			codes[i] = do(user, http.MethodPatch, fmt.Sprintf("/private/org/members/%d", users[target].ID), o.ID, map[string]string{"role": models.RoleMember}).Code
+		}(i, pair[0], pair[1])
+	}
+	wg.Wait()
+	// the other one gets 409, or 403 if it was demoted before its request started
+	assert.Contains(t, codes, http.StatusOK)
+	assert.NotEqual(t, codes[0], codes[1])
+
+	members, err := store.Membership().ListByOrganization(ctx, o.ID)
+	assert.NoError(t, err)
+	owners := 0
+	for _, m := range members {
+		if m.Role == models.RoleOwner {
+			owners++
+		}
+	}
+	assert.Equal(t, 1, owners)
+
+	// role of the caller is read again in the transaction, the one loaded for the request may be stale
+	demoted := users["owner"]
+	if codes[0] == http.StatusOK {
+		demoted = users["admin"]
+	}
+
+	req, _ := http.NewRequest(http.MethodPatch, "/", bytes.NewReader([]byte(`{"role":"owner"}`)))
+	req = mux.SetURLVars(req, map[string]string{"user_id": strconv.Itoa(users["member"].ID)})
+	req = req.WithContext(context.WithValue(req.Context(), ctxKeyMembership, &models.Membership{
+		OrganizationID: o.ID,
+		UserID:         demoted.ID,
+		Role:           models.RoleOwner,
+	}))
+	rec = httptest.NewRecorder()
+	s.handleMembersUpdate().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
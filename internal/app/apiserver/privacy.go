@@ -0,0 +1,312 @@
+package apiserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/gopherschool/http-rest-api/internal/app/blobstore"
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/privacy"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+var (
+	errExportNotReady      = errors.New("data export is not completed yet")
+	errPasswordRequired    = errors.New("password confirmation is required")
+	errIncorrectPassword   = errors.New("incorrect password")
+	errDataExportNotFound  = errors.New("data export not found")
+	errInvalidDataExportID = errors.New("invalid data export id")
+	errExportGone          = errors.New("data export archive is no longer available, request a new export")
+	errErasing             = errors.New("account is being erased")
+	errExportRunning       = errors.New("data export is already in progress, wait until it's completed")
+)
+
+// exportJobs tracks running data exports by user. A user has one running export at most, archives are
+// built in memory. Erasure stops them, otherwise a job could save an archive with personal data
+// after the erasure has deleted archives of the user
+type exportJobs struct {
+	mu      sync.Mutex
+	running map[int]*exportJob
+	erasing map[int]bool
+}
+
+type exportJob struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newExportJobs() *exportJobs {
+	return &exportJobs{running: make(map[int]*exportJob), erasing: make(map[int]bool)}
+}
+
+// start registers a job of user. The job must run with returned context and call finish when it's done.
+// Jobs can't be started while user is being erased or has another job running
+func (j *exportJobs) start(userID int) (ctx context.Context, finish func(), err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.erasing[userID] {
+		return nil, nil, errErasing
+	}
+
+	if j.running[userID] != nil {
+		return nil, nil, errExportRunning
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &exportJob{cancel: cancel, done: make(chan struct{})}
+	j.running[userID] = job
+
+	return ctx, func() {
+		cancel()
+		close(job.done)
+
+		j.mu.Lock()
+		defer j.mu.Unlock()
+
+		delete(j.running, userID)
+	}, nil
+}
+
+// stop cancels job of user and waits until it's finished. New jobs can't be started
+// until release is called, it must be called even if stop fails
+func (j *exportJobs) stop(ctx context.Context, userID int) (release func(), err error) {
+	j.mu.Lock()
+	j.erasing[userID] = true
+	job := j.running[userID]
+	j.mu.Unlock()
+
+	release = func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+
+		delete(j.erasing, userID)
+	}
+
+	if job == nil {
+		return release, nil
+	}
+
+	job.cancel()
+	select {
+	case <-job.done:
+		return release, nil
+	case <-ctx.Done():
+		return release, ctx.Err()
+	}
+}
+
+// handleDataExportCreate starts assembling archive with user's data in background.
+// Client polls GET /private/data-export/{id} until status is completed and then downloads the archive
+func (s *server) handleDataExportCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.exportStore == nil {
+			s.error(w, r, http.StatusInternalServerError, errNoBlobStore)
+			return
+		}
+
+		u := r.Context().Value(ctxKeyUser).(*models.User)
+		// request is finished before the job, so its context can't be used there
+		ctx, finish, err := s.exportJobs.start(u.ID)
+		if err != nil {
+			s.error(w, r, http.StatusConflict, err)
+			return
+		}
+
+		e := &models.DataExport{UserID: u.ID, Status: models.DataExportPending}
+		if err := s.store.DataExport().Create(r.Context(), e); err != nil {
+			finish()
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		// the job changes its own copy, e is rendered below meanwhile
+		job := *e
+		s.jobs.Add(1)
+		go func() {
+			defer s.jobs.Done()
+			defer finish()
+			// replicas may not have the export yet, so everything is read from the primary
+			s.runDataExport(store.WithPrimary(ctx), &job)
+		}()
+
+		s.respond(w, r, http.StatusAccepted, e)
+	}
+}
+
+// runDataExport builds archive and saves result of the job. Request is already finished at this point,
+// so errors are only logged and saved to the export. ctx is cancelled when user is erased
+func (s *server) runDataExport(ctx context.Context, e *models.DataExport) {
+	logger := s.logger.WithFields(logrus.Fields{
+		"user_id":        e.UserID,
+		"data_export_id": e.ID,
+	})
+
+	// user of the request could be erased before the job was registered
+	u, err := s.store.User().FindByID(ctx, e.UserID)
+	if err == nil && u.IsErased() {
+		err = errErasing
+	}
+
+	b := &bytes.Buffer{}
+	if err == nil {
+		err = privacy.BuildExport(ctx, b, s.store, s.blobStore, u)
+	}
+
+	// archive must not be saved after erasure has started
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	if err == nil {
+		e.BlobKey = privacy.ExportKey(e)
+		err = s.exportStore.Put(e.BlobKey, b, privacy.ExportContentType)
+	}
+
+	now := time.Now()
+	e.CompletedAt = &now
+	e.Status = models.DataExportCompleted
+	if err != nil {
+		logger.Errorf("data export failed: %v", err)
+		e.Status = models.DataExportFailed
+		e.BlobKey = ""
+		e.Error = "export failed, please try again later" // details are in log only
+	}
+
+	// ctx may be cancelled by erasure, the result is saved anyway
+	err = s.store.DataExport().Update(store.WithPrimary(context.Background()), e)
+	if err == store.ErrRecordNotFound && e.BlobKey != "" {
+		// the export was deleted meanwhile, e.g. by erasure on another instance
+		err = s.exportStore.Delete(e.BlobKey)
+	}
+
+	if err != nil && err != store.ErrRecordNotFound {
+		logger.Errorf("failed to save data export: %v", err)
+	}
+}
+
+// handleDataExportGet renders status of user's export
+func (s *server) handleDataExportGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e, ok := s.findDataExport(w, r)
+		if !ok {
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, e)
+	}
+}
+
+// handleDataExportDownload streams completed archive from blob store
+func (s *server) handleDataExportDownload() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e, ok := s.findDataExport(w, r)
+		if !ok {
+			return
+		}
+
+		if e.Status != models.DataExportCompleted {
+			s.error(w, r, http.StatusConflict, errExportNotReady)
+			return
+		}
+
+		f, err := s.exportStore.Open(e.BlobKey)
+		if err != nil {
+			if err == blobstore.ErrNotFound {
+				s.error(w, r, http.StatusGone, errExportGone)
+				return
+			}
+
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		defer f.Close()
+
+		w.Header().Set("Content-Type", privacy.ExportContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="data-export-%d.zip"`, e.ID))
+		w.WriteHeader(http.StatusOK)
+		io.Copy(w, f)
+	}
+}
+
+// findDataExport loads export from URL. Exports of other users look like non-existent ones
+func (s *server) findDataExport(w http.ResponseWriter, r *http.Request) (*models.DataExport, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.error(w, r, http.StatusBadRequest, errInvalidDataExportID)
+		return nil, false
+	}
+
+	u := r.Context().Value(ctxKeyUser).(*models.User)
+	e, err := s.store.DataExport().FindByID(r.Context(), id)
+	if err != nil && err != store.ErrRecordNotFound {
+		s.error(w, r, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	if err == store.ErrRecordNotFound || e.UserID != u.ID {
+		s.error(w, r, http.StatusNotFound, errDataExportNotFound)
+		return nil, false
+	}
+
+	return e, true
+}
+
+// handleUsersErase is the right to erasure: personal data is removed and the account can't be used anymore.
+// Password is asked again, so a stolen session is not enough to destroy the account
+func (s *server) handleUsersErase() http.HandlerFunc {
+	type request struct {
+		Password string `json:"password"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &request{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.Password == "" {
+			s.error(w, r, http.StatusBadRequest, errPasswordRequired)
+			return
+		}
+
+		u := r.Context().Value(ctxKeyUser).(*models.User)
+		if !u.ComparePasswords(req.Password) {
+			s.error(w, r, http.StatusForbidden, errIncorrectPassword)
+			return
+		}
+
+		// a running export could save an archive after erasure has deleted archives
+		release, err := s.exportJobs.stop(r.Context(), u.ID)
+		defer release()
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := privacy.Erase(r.Context(), s.store, s.blobStore, s.exportStore, u); err != nil {
+			if err == privacy.ErrSoleOwner {
+				s.error(w, r, http.StatusConflict, err)
+				return
+			}
+
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		// user doesn't exist anymore, so the session cookie is useless
+		if session, err := s.sessionStore.Get(r, sessionName); err == nil {
+			session.Options.MaxAge = -1
+			s.sessionStore.Save(r, w, session)
+		}
+
+		s.respond(w, r, http.StatusNoContent, nil)
+	}
+}
@@ -0,0 +1,206 @@
+package apiserver
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/blobstore"
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/privacy"
+	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
+)
+
+func TestServerDataExport(t *testing.T) {
+	ctx := context.Background()
+	store := teststore.NewStore()
+	u := models.TestUser(t)
+	store.User().Create(ctx, u)
+	other := models.TestUser(t)
+	other.Email = "other@example.org"
+	store.User().Create(ctx, other)
+
+	secretKey := []byte("secret")
+	s := newServer(store, sessions.NewCookieStore(secretKey))
+	blobs, err := blobstore.NewLocalStore(t.TempDir(), "/uploads")
+	assert.NoError(t, err)
+	s.blobStore = blobs
+	exports, err := blobstore.NewLocalStore(t.TempDir(), "")
+	assert.NoError(t, err)
+	s.exportStore = exports
+
+	do := func(userID int, method, url string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, nil)
+		setSession(t, req, secretKey, userID)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(u.ID, http.MethodPost, "/private/data-export")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	e := &models.DataExport{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(e))
+	assert.Equal(t, models.DataExportPending, e.Status)
+
+	s.jobs.Wait()
+
+	rec = do(u.ID, http.MethodGet, fmt.Sprintf("/private/data-export/%d", e.ID))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(e))
+	assert.Equal(t, models.DataExportCompleted, e.Status)
+
+	// other users can't even see that export exists
+	rec = do(other.ID, http.MethodGet, fmt.Sprintf("/private/data-export/%d/download", e.ID))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = do(u.ID, http.MethodGet, fmt.Sprintf("/private/data-export/%d/download", e.ID))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	assert.NoError(t, err)
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		assert.NoError(t, err)
+		files[f.Name], _ = ioutil.ReadAll(r)
+		r.Close()
+	}
+
+	assert.Contains(t, files, "profile.json")
+	assert.Contains(t, string(files["profile.json"]), u.Email)
+	assert.NotContains(t, string(files["profile.json"]), u.EncryptedPassword)
+
+	// archive is only in the private store
+	key := privacy.ExportKey(e)
+	_, err = blobs.Open(key)
+	assert.ErrorIs(t, err, blobstore.ErrNotFound)
+
+	assert.NoError(t, exports.Delete(key))
+	rec = do(u.ID, http.MethodGet, fmt.Sprintf("/private/data-export/%d/download", e.ID))
+	assert.Equal(t, http.StatusGone, rec.Code)
+}
+
+func TestExportJobs(t *testing.T) {
+	j := newExportJobs()
+	ctx, finish, err := j.start(1)
+	assert.NoError(t, err)
+
+	// one job per user
+	_, _, err = j.start(1)
+	assert.ErrorIs(t, err, errExportRunning)
+
+	// erasure cancels the job and waits until it's finished
+	stopped := make(chan struct{})
+	var release func()
+	go func() {
+		defer close(stopped)
+		release, err = j.stop(context.Background(), 1)
+	}()
+
+	<-ctx.Done()
+	select {
+	case <-stopped:
+		t.Fatal("stop returned before the job was finished")
+	default:
+	}
+
+	finish()
+	<-stopped
+	assert.NoError(t, err)
+
+	// no new jobs until erasure is finished
+	_, _, err = j.start(1)
+	assert.ErrorIs(t, err, errErasing)
+	_, finishOther, err := j.start(2)
+	assert.NoError(t, err)
+	finishOther()
+
+	release()
+	_, finish, err = j.start(1)
+	assert.NoError(t, err)
+	finish()
+}
+
+func TestServerHandleUsersErase(t *testing.T) {
+	ctx := context.Background()
+	store := teststore.NewStore()
+	u := models.TestUser(t)
+	store.User().Create(ctx, u)
+	other := models.TestUser(t)
+	other.Email = "other@example.org"
+	store.User().Create(ctx, other)
+
+	o := &models.Organization{Name: "Acme"}
+	store.Organization().Create(ctx, o)
+	store.Membership().Create(ctx, &models.Membership{OrganizationID: o.ID, UserID: u.ID, Role: models.RoleOwner})
+	store.Membership().Create(ctx, &models.Membership{OrganizationID: o.ID, UserID: other.ID, Role: models.RoleMember})
+	// nobody else is in this one, it goes together with the user
+	solo := &models.Organization{Name: "Solo"}
+	store.Organization().Create(ctx, solo)
+	store.Membership().Create(ctx, &models.Membership{OrganizationID: solo.ID, UserID: u.ID, Role: models.RoleOwner})
+
+	secretKey := []byte("secret")
+	s := newServer(store, sessions.NewCookieStore(secretKey))
+	exports, err := blobstore.NewLocalStore(t.TempDir(), "")
+	assert.NoError(t, err)
+	s.exportStore = exports
+
+	// archive of a job which failed to save its key is deleted too
+	e := &models.DataExport{UserID: u.ID, Status: models.DataExportFailed}
+	assert.NoError(t, store.DataExport().Create(ctx, e))
+	assert.NoError(t, exports.Put(privacy.ExportKey(e), bytes.NewReader([]byte("archive")), privacy.ExportContentType))
+
+	do := func(userID int, method, url string, payload interface{}) *httptest.ResponseRecorder {
+		b := &bytes.Buffer{}
+		if payload != nil {
+			json.NewEncoder(b).Encode(payload)
+		}
+
+		req, _ := http.NewRequest(method, url, b)
+		setSession(t, req, secretKey, userID)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(u.ID, http.MethodDelete, "/private/users/me", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = do(u.ID, http.MethodDelete, "/private/users/me", map[string]string{"password": "wrong"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// organization would be left without owner
+	rec = do(u.ID, http.MethodDelete, "/private/users/me", map[string]string{"password": "password"})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	assert.NoError(t, store.Membership().UpdateRole(ctx, &models.Membership{OrganizationID: o.ID, UserID: other.ID, Role: models.RoleOwner}))
+
+	rec = do(u.ID, http.MethodDelete, "/private/users/me", map[string]string{"password": "password"})
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = do(u.ID, http.MethodGet, "/private/whoami", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = do(0, http.MethodPost, "/sessions", map[string]string{"email": "user@example.org", "password": "password"})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	members, err := store.Membership().ListByOrganization(ctx, o.ID)
+	assert.NoError(t, err)
+	assert.Len(t, members, 1)
+	_, err = store.Organization().FindByID(ctx, solo.ID)
+	assert.Error(t, err)
+
+	_, err = exports.Open(privacy.ExportKey(e))
+	assert.ErrorIs(t, err, blobstore.ErrNotFound)
+}
@@ -0,0 +1,77 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// newHTTPServer applies timeouts from config, so slow clients can't hold connections forever
+func newHTTPServer(config *Config, h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              config.BindAddr,
+		Handler:           h,
+		ReadHeaderTimeout: config.ReadHeaderTimeout.Duration,
+		ReadTimeout:       config.ReadTimeout.Duration,
+		WriteTimeout:      config.WriteTimeout.Duration,
+		IdleTimeout:       config.IdleTimeout.Duration,
+	}
+}
+
+// shutdownOptions configure graceful shutdown of serve
+type shutdownOptions struct {
+	// delay between failing readiness probe and closing listeners,
+	// orchestrator needs some time to notice it and stop sending new requests
+	delay time.Duration
+	// gracePeriod limits waiting for in-flight requests and background jobs
+	gracePeriod time.Duration
+}
+
+// serve runs listen (e.g. httpServer.ListenAndServe) until a signal comes from stop. Then readiness probe
+// starts to fail, and after opts.delay the server stops accepting connections and waits for requests
+// and background jobs started by them. serve returns only after that, so the caller can close the database
+func (s *server) serve(httpServer *http.Server, listen func() error, stop <-chan os.Signal, opts shutdownOptions) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- listen()
+	}()
+
+	select {
+	case err := <-errc:
+		// listener has failed before any signal, e.g. the port is busy
+		return err
+	case sig := <-stop:
+		s.logger.Infof("got %s, shutting down", sig)
+	}
+
+	s.setDraining()
+	time.Sleep(opts.delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.gracePeriod)
+	defer cancel()
+
+	if err := httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("requests didn't finish in %s: %w", opts.gracePeriod, err)
+	}
+
+	if err := <-errc; err != http.ErrServerClosed {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.jobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("background jobs didn't finish in %s", opts.gracePeriod)
+	}
+
+	s.logger.Info("server stopped")
+	return nil
+}
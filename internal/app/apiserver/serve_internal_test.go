@@ -0,0 +1,69 @@
+package apiserver
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
+)
+
+func TestServerServe(t *testing.T) {
+	s := newServer(teststore.NewStore(), sessions.NewCookieStore([]byte("secret")))
+	started := make(chan struct{})
+	jobDone := false
+	s.router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		s.jobs.Add(1)
+		go func() {
+			defer s.jobs.Done()
+			time.Sleep(100 * time.Millisecond)
+			jobDone = true
+		}()
+
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	httpServer := newHTTPServer(NewConfig(), s)
+	stop := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.serve(httpServer, func() error { return httpServer.Serve(ln) }, stop, shutdownOptions{
+			gracePeriod: time.Second,
+		})
+	}()
+
+	res := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			res <- 0
+			return
+		}
+		resp.Body.Close()
+		res <- resp.StatusCode
+	}()
+
+	// in-flight request and its job finish, although the signal comes in the middle
+	<-started
+	stop <- syscall.SIGTERM
+	assert.Equal(t, http.StatusOK, <-res)
+	assert.NoError(t, <-served)
+	assert.True(t, jobDone)
+	assert.True(t, s.isDraining())
+
+	_, err = http.Get("http://" + ln.Addr().String() + "/healthz")
+	assert.Error(t, err)
+}
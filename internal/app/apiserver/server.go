@@ -1,18 +1,30 @@
 package apiserver
 
 import (
+	"bytes"
 	"context"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
+	"expvar"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"github.com/sirupsen/logrus"
 
+	"github.com/gopherschool/http-rest-api/internal/app/avatar"
+	"github.com/gopherschool/http-rest-api/internal/app/blobstore"
+	"github.com/gopherschool/http-rest-api/internal/app/mailer"
 	"github.com/gopherschool/http-rest-api/internal/app/models"
 	"github.com/gopherschool/http-rest-api/internal/app/store"
 )
@@ -23,31 +35,72 @@ const (
 	sessionName        = "simple_session_name" // will be returned as response cookie - Set-Cookie: simple_session_name=MTN..
 	ctxKeyUser  ctxKey = iota                  // TODO: what is iota?
 	ctxKeyRequestID
+	ctxKeyOrganization
+	ctxKeyMembership // membership of authenticated user in organization from ctxKeyOrganization
+	ctxKeyInvitation
+)
+
+// defaultAvatarMaxSize limits size of uploaded avatars if nothing else is configured
+const defaultAvatarMaxSize = 5 << 20 // 5 MB
+
+// avatarFormField is the name of file field for multipart uploads
+const avatarFormField = "avatar"
+
+// pagination defaults for list endpoints
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
 )
 
 // create common error for both wrong email and password (more secire way)
 var (
 	errIncorrectEmailOrPassword = errors.New("incorrect email or password")
 	errNotAuthenticated         = errors.New("not authenticated")
+	errEmailAlreadyTaken        = errors.New("email is already taken")
+	errForbidden                = errors.New("forbidden")
+	errEmptySearchQuery         = errors.New("search query is empty")
+	errInvalidPagination        = errors.New("invalid limit or offset")
+	errUploadTooLarge           = errors.New("uploaded file is too large")
+	errNoBlobStore              = errors.New("file uploads are not configured")
 )
 
 type ctxKey int8
 
 type server struct {
-	router       *mux.Router
-	logger       *logrus.Logger
-	store        store.Store    // it's an interface
-	sessionStore sessions.Store // gorilla session. Will be returned as response cookie
+	router        *mux.Router
+	logger        *logrus.Logger
+	store         store.Store         // it's an interface
+	sessionStore  sessions.Store      // gorilla session. Will be returned as response cookie
+	blobStore     blobstore.BlobStore // uploaded files, set in Start
+	exportStore   blobstore.BlobStore // archives of data exports, never served as files, set in Start
+	avatarMaxSize int64
+	mailer        mailer.Mailer
+	publicURL     string // used for links in emails
+
+	invitationCodec *securecookie.SecureCookie // signs invitation tokens
+	invitationTTL   time.Duration
+
+	jobs       sync.WaitGroup // background jobs started by handlers, e.g. data exports
+	exportJobs *exportJobs    // running data exports by user, erasure stops them
+
+	schema   schemaVersioner // checked by readiness probe, nil for memory store
+	draining int32           // set on shutdown, see setDraining
 }
 
 // newServer accepts store interface
 func newServer(store store.Store, sessionStore sessions.Store) *server {
 	s := &server{
-		router:       mux.NewRouter(),
-		logger:       logrus.New(),
-		store:        store,
-		sessionStore: sessionStore,
+		router:        mux.NewRouter(),
+		logger:        logrus.New(),
+		store:         store,
+		sessionStore:  sessionStore,
+		avatarMaxSize: defaultAvatarMaxSize,
+		invitationTTL: defaultInvitationTTL,
+		exportJobs:    newExportJobs(),
 	}
+	// defaults are good for tests, Start replaces them with values from config
+	s.mailer = mailer.NewLogMailer(s.logger)
+	s.invitationCodec = newInvitationCodec(securecookie.GenerateRandomKey(32), s.invitationTTL)
 	s.configureRouter()
 	return s
 }
@@ -59,9 +112,14 @@ func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (s *server) configureRouter() {
 	// added middleware that sets request ID at the beginning
 	s.router.Use(s.setRequestID)
+	s.router.Use(s.trackWrites)
 	s.router.Use(s.logRequest)
 	// Allow requests from all sources. Response will contain headers "Access-Control-Allow-Origin: *"
 	s.router.Use(handlers.CORS(handlers.AllowedOrigins([]string{"*"})))
+	// probes of orchestrator, no authentication
+	s.router.HandleFunc("/healthz", s.handleHealthz()).Methods("GET")
+	s.router.HandleFunc("/readyz", s.handleReadyz()).Methods("GET")
+	s.router.HandleFunc("/version", s.handleVersion()).Methods("GET")
 	s.router.HandleFunc("/users", s.handleUsersCreate()).Methods("POST")
 	// Create new session for user. Will be returned as response header
 	s.router.HandleFunc("/sessions", s.handleSessionsCreate()).Methods("POST")
@@ -72,6 +130,47 @@ func (s *server) configureRouter() {
 	private := s.router.PathPrefix("/private").Subrouter()
 	private.Use(s.authenticateUser)
 	private.HandleFunc("/whoami", s.handleWhoami()).Methods("GET")
+	private.HandleFunc("/users/me/avatar", s.handleAvatarUpload()).Methods("PUT")
+	private.HandleFunc("/users/me", s.handleUsersUpdateMe()).Methods("PATCH")
+	private.HandleFunc("/users/me", s.handleUsersErase()).Methods("DELETE")
+	private.HandleFunc("/orgs", s.handleOrganizationsCreate()).Methods("POST")
+	private.HandleFunc("/data-export", s.handleDataExportCreate()).Methods("POST")
+	private.HandleFunc("/data-export/{id:[0-9]+}", s.handleDataExportGet()).Methods("GET")
+	private.HandleFunc("/data-export/{id:[0-9]+}/download", s.handleDataExportDownload()).Methods("GET")
+
+	// organization scoped endpoints, organization is taken from X-Org-ID header
+	org := private.PathPrefix("/org").Subrouter()
+	org.Use(s.resolveOrganization)
+	org.HandleFunc("/members", s.handleMembersList()).Methods("GET")
+	org.HandleFunc("/members/{user_id:[0-9]+}", s.handleMembersUpdate()).Methods("PATCH")
+
+	// invitations are created inside of organization from X-Org-ID,
+	// but can be previewed and accepted by anybody who has the token
+	invitations := private.PathPrefix("/invitations").Subrouter()
+	invitations.Use(s.resolveOrganization)
+	invitations.HandleFunc("", s.handleInvitationsCreate()).Methods("POST")
+
+	invitation := s.router.PathPrefix("/invitations/{token}").Subrouter()
+	invitation.Use(s.resolveInvitation)
+	invitation.HandleFunc("", s.handleInvitationsPreview()).Methods("GET")
+	invitation.HandleFunc("/accept", s.handleInvitationsAccept()).Methods("POST")
+
+	// admin endpoints require authenticated user with admin flag
+	admin := s.router.PathPrefix("/admin").Subrouter()
+	admin.Use(s.authenticateUser)
+	admin.Use(s.requireAdmin)
+	admin.HandleFunc("/users/search", s.handleUsersSearch()).Methods("GET")
+	admin.HandleFunc("/users/{id:[0-9]+}", s.handleAdminUsersGet()).Methods("GET")
+	admin.HandleFunc("/users/{id:[0-9]+}", s.handleAdminUsersUpdate()).Methods("PATCH")
+	// expvar: connection pool, user cache and runtime statistics
+	admin.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+}
+
+// serveBlobs makes avatars from blob store available by URL prefix, e.g. /uploads/avatars/1/64.png.
+// Nothing else from the store is served, whatever else gets there must not become public
+func (s *server) serveBlobs(prefix string, h http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	s.router.PathPrefix(prefix+"/"+avatar.KeyPrefix).Handler(http.StripPrefix(prefix, h)).Methods("GET", "HEAD")
 }
 
 // setRequestID middleware will set unique ID for every input request that will be returned in header and used inside of our system
@@ -86,6 +185,11 @@ func (s *server) setRequestID(next http.Handler) http.Handler {
 // logRequest ...
 func (s *server) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if quietPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		logger := s.logger.WithFields(logrus.Fields{
 			"remote_addr": r.RemoteAddr,
 			"request_id":  r.Context().Value(ctxKeyRequestID),
@@ -111,24 +215,20 @@ func (s *server) logRequest(next http.Handler) http.Handler {
 // authenticateUser accept next handler/middleware
 func (s *server) authenticateUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// firstly, get current user's session from its request
-		session, err := s.sessionStore.Get(r, sessionName)
-		if err != nil {
-			// return 500 because it's our error
-			s.error(w, r, http.StatusInternalServerError, err)
-			return
+		// internal services authenticate with client certificates, everyone else with the session cookie
+		u, err := s.certificateUser(r)
+		if err == errNotAuthenticated {
+			u, err = s.sessionUser(r)
 		}
 
-		// get user ID from session. `Values` is one of session's parameters
-		id, ok := session.Values["user_id"]
-		if !ok {
-			s.error(w, r, http.StatusUnauthorized, errNotAuthenticated)
-			return
-		}
-
-		u, err := s.store.User().FindByID(id.(int))
 		if err != nil {
-			s.error(w, r, http.StatusUnauthorized, errNotAuthenticated)
+			if err == errNotAuthenticated {
+				s.error(w, r, http.StatusUnauthorized, err)
+				return
+			}
+
+			// return 500 because it's our error
+			s.error(w, r, http.StatusInternalServerError, err)
 			return
 		}
 
@@ -145,12 +245,105 @@ func (s *server) authenticateUser(next http.Handler) http.Handler {
 	})
 }
 
+// sessionUser finds user by ID from session cookie. errNotAuthenticated means there is no valid session
+func (s *server) sessionUser(r *http.Request) (*models.User, error) {
+	// firstly, get current user's session from its request
+	session, err := s.sessionStore.Get(r, sessionName)
+	if err != nil {
+		return nil, err
+	}
+
+	// get user ID from session. `Values` is one of session's parameters
+	id, ok := session.Values["user_id"].(int)
+	if !ok {
+		return nil, errNotAuthenticated
+	}
+
+	u, err := s.store.User().FindByID(r.Context(), id)
+	if err != nil || u.IsErased() {
+		return nil, errNotAuthenticated
+	}
+
+	return u, nil
+}
+
+// certificateUser finds user mapped to the client certificate, which is verified by TLS layer against
+// tls_client_ca_file. Subject DN is tried first, then DNS names, emails and URIs from SAN.
+// errNotAuthenticated means there is no verified certificate or none of its names is mapped
+func (s *server) certificateUser(r *http.Request) (*models.User, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, errNotAuthenticated
+	}
+
+	for _, subject := range certificateSubjects(r.TLS.VerifiedChains[0][0]) {
+		u, err := s.store.User().FindByCertificateSubject(r.Context(), subject)
+		if err == store.ErrRecordNotFound {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if u.IsErased() {
+			return nil, errNotAuthenticated
+		}
+
+		return u, nil
+	}
+
+	return nil, errNotAuthenticated
+}
+
+// certificateSubjects returns typed names of certificate in the order they are looked up, e.g. "dn:CN=billing,O=Acme",
+// "dns:billing.internal", "email:billing@example.org", "uri:spiffe://example.org/billing". The type is a part
+// of the name, so e.g. a DNS name can't match mapping of a DN
+func certificateSubjects(cert *x509.Certificate) []string {
+	subjects := []string{models.CertificateDN + cert.Subject.String()}
+	for _, name := range cert.DNSNames {
+		subjects = append(subjects, models.CertificateDNS+name)
+	}
+
+	for _, email := range cert.EmailAddresses {
+		subjects = append(subjects, models.CertificateEmail+email)
+	}
+
+	for _, uri := range cert.URIs {
+		subjects = append(subjects, models.CertificateURI+uri.String())
+	}
+
+	return subjects
+}
+
+// trackWrites lets the store send reads of a request to the primary database after the request has written
+// something, so replication lag never hides the request's own changes
+func (s *server) trackWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(store.WithWriteTracking(r.Context())))
+	})
+}
+
+// requireAdmin must go after authenticateUser, because it takes user from context
+func (s *server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := r.Context().Value(ctxKeyUser).(*models.User)
+		if !ok || !u.IsAdmin {
+			s.error(w, r, http.StatusForbidden, errForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // handleWhoami renders user that will be taken from context
 // we assume here that user is already logged in and we have written him into context and can make a call to him
 func (s *server) handleWhoami() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// transform context key user to *models.User type
-		s.respond(w, r, http.StatusOK, r.Context().Value(ctxKeyUser).(*models.User))
+		// transform context key user to *models.User type, ETag is needed for later updates
+		u := r.Context().Value(ctxKeyUser).(*models.User)
+		w.Header().Set("ETag", userETag(u))
+		s.respond(w, r, http.StatusOK, u)
 	}
 }
 
@@ -174,9 +367,17 @@ func (s *server) handleUsersCreate() http.HandlerFunc {
 			Password: req.Password,
 		}
 
-		if err := s.store.User().Create(u); err != nil {
-			// User send incorrect data - 422 error
-			s.error(w, r, http.StatusUnprocessableEntity, err)
+		if err := s.store.User().Create(r.Context(), u); err != nil {
+			switch {
+			case errors.Is(err, store.ErrDuplicate):
+				// user with the same email already exists - 409 error without any details from DB
+				s.error(w, r, http.StatusConflict, errEmailAlreadyTaken)
+			case errors.Is(err, store.ErrConflict):
+				s.error(w, r, http.StatusConflict, err)
+			default:
+				// User send incorrect data - 422 error
+				s.error(w, r, http.StatusUnprocessableEntity, err)
+			}
 			return
 		}
 
@@ -202,33 +403,231 @@ func (s *server) handleSessionsCreate() http.HandlerFunc {
 		}
 
 		// find user by email and check that email is OK and passed password corresponds to encrypted one in store
-		u, err := s.store.User().FindByEmail(req.Email)
+		u, err := s.store.User().FindByEmail(r.Context(), req.Email)
 		if err != nil || !u.ComparePasswords(req.Password) {
 			s.error(w, r, http.StatusUnauthorized, errIncorrectEmailOrPassword)
 			return
 		}
-		// return cookie to user after successful authentication
-		// using gorilla/sessions package for that
-		session, err := s.sessionStore.Get(r, sessionName)
-		if err != nil {
+
+		// imported users may still have hashes from other systems.
+		// password is known right now, so replace such hash with the current algorithm
+		if u.NeedsRehash() {
+			s.rehashPassword(r, u, req.Password)
+		}
+
+		if err := s.startSession(w, r, u); err != nil {
 			// return internal server error because problem is on our side
 			s.error(w, r, http.StatusInternalServerError, err)
 			return
 		}
 
-		// Need to add middleware that gets user_id from session during every request, then goes to the store with user_id,
-		// then gets user. If user exists - add it to context of current request. If not, return 401 error.
+		s.respond(w, r, http.StatusOK, nil)
+	}
+}
+
+// startSession returns cookie to user after successful authentication
+// using gorilla/sessions package for that
+func (s *server) startSession(w http.ResponseWriter, r *http.Request, u *models.User) error {
+	session, err := s.sessionStore.Get(r, sessionName)
+	if err != nil {
+		return err
+	}
+
+	// Need to add middleware that gets user_id from session during every request, then goes to the store with user_id,
+	// then gets user. If user exists - add it to context of current request. If not, return 401 error.
+
+	// Load session if it has user ID. Otherwise, return unauthorized error or smth else
+	session.Values["user_id"] = u.ID
+	// Saving current session
+	return s.sessionStore.Save(r, w, session)
+}
+
+// handleUsersSearch finds users by part of email: GET /admin/users/search?q=john&limit=20&offset=0
+func (s *server) handleUsersSearch() http.HandlerFunc {
+	type response struct {
+		Users  []*models.User `json:"users"`
+		Limit  int            `json:"limit"`
+		Offset int            `json:"offset"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+		if q == "" {
+			s.error(w, r, http.StatusBadRequest, errEmptySearchQuery)
+			return
+		}
+
+		limit, offset, err := parsePagination(r)
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		users, err := s.store.User().Search(r.Context(), q, limit, offset)
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		for _, u := range users {
+			u.Sanitize()
+		}
+
+		s.respond(w, r, http.StatusOK, &response{Users: users, Limit: limit, Offset: offset})
+	}
+}
+
+// handleAvatarUpload accepts image either as multipart form with `avatar` file field or as raw request body.
+// Thumbnails are saved to blob store and link to the large one is rendered as user's avatar_url
+func (s *server) handleAvatarUpload() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.blobStore == nil {
+			s.error(w, r, http.StatusInternalServerError, errNoBlobStore)
+			return
+		}
+
+		u := r.Context().Value(ctxKeyUser).(*models.User)
+		// checked before anything is uploaded, the store checks it again when saving
+		if err := checkIfMatch(r, u); err != nil {
+			s.preconditionError(w, r, err)
+			return
+		}
+
+		data, err := s.readUpload(w, r, avatarFormField, s.avatarMaxSize)
+		if err != nil {
+			if err == errUploadTooLarge {
+				s.error(w, r, http.StatusRequestEntityTooLarge, err)
+				return
+			}
+
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		thumbs, err := avatar.Thumbnails(data)
+		if err != nil {
+			if errors.Is(err, avatar.ErrUnsupportedFormat) {
+				s.error(w, r, http.StatusUnsupportedMediaType, err)
+				return
+			}
+
+			s.error(w, r, http.StatusUnprocessableEntity, err)
+			return
+		}
+
+		for size, thumb := range thumbs {
+			if err := s.blobStore.Put(avatar.Key(u.ID, size), bytes.NewReader(thumb), avatar.ContentType); err != nil {
+				s.error(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		// keys are the same for every upload, so version in URL makes clients (and caches) load the new picture
+		u.AvatarURL = s.blobStore.URL(avatar.Key(u.ID, avatar.LargeSize)) + "?v=" + strconv.FormatInt(time.Now().Unix(), 10)
+		if err := s.store.User().UpdateAvatarURL(r.Context(), u); err != nil {
+			if errors.Is(err, store.ErrConflict) {
+				s.error(w, r, http.StatusPreconditionFailed, errPreconditionFailed)
+				return
+			}
 
-		// Load session if it has user ID. Otherwise, return unauthorized error or smth else
-		session.Values["user_id"] = u.ID
-		// Saving current session
-		if err := s.sessionStore.Save(r, w, session); err != nil {
 			s.error(w, r, http.StatusInternalServerError, err)
 			return
 		}
 
-		s.respond(w, r, http.StatusOK, nil)
+		s.respondUser(w, r, http.StatusOK, u)
+	}
+}
+
+// readUpload returns uploaded file from multipart form field or the whole body for any other content type.
+// Anything bigger than maxSize is rejected with errUploadTooLarge
+func (s *server) readUpload(w http.ResponseWriter, r *http.Request, field string, maxSize int64) ([]byte, error) {
+	var src io.Reader = http.MaxBytesReader(w, r.Body, maxSize)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		// the whole form is limited by maxSize plus a bit for part headers
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<10)
+		if err := r.ParseMultipartForm(maxSize); err != nil {
+			if isBodyTooLarge(err) {
+				return nil, errUploadTooLarge
+			}
+
+			return nil, err
+		}
+
+		f, _, err := r.FormFile(field)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		src = io.LimitReader(f, maxSize+1)
+	}
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		if isBodyTooLarge(err) {
+			return nil, errUploadTooLarge
+		}
+
+		return nil, err
+	}
+
+	if int64(len(data)) > maxSize {
+		return nil, errUploadTooLarge
+	}
+
+	return data, nil
+}
+
+// isBodyTooLarge checks error returned by http.MaxBytesReader, also when it's wrapped by mime/multipart
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// parsePagination reads `limit` and `offset` query parameters, both are optional
+func parsePagination(r *http.Request) (limit, offset int, err error) {
+	limit, offset = defaultPageLimit, 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return 0, 0, errInvalidPagination
+		}
+
+		if limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+	}
+
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, errInvalidPagination
+		}
 	}
+
+	return limit, offset, nil
+}
+
+// rehashPassword replaces legacy password hash. Failure here isn't a reason to fail the login,
+// user will be rehashed next time
+func (s *server) rehashPassword(r *http.Request, u *models.User, password string) {
+	logger := s.logger.WithFields(logrus.Fields{
+		"request_id": r.Context().Value(ctxKeyRequestID),
+		"user_id":    u.ID,
+	})
+
+	if err := u.SetPassword(password); err != nil {
+		logger.Warnf("failed to rehash password: %v", err)
+		return
+	}
+
+	if err := s.store.User().UpdateEncryptedPassword(r.Context(), u); err != nil {
+		logger.Warnf("failed to save rehashed password: %v", err)
+		return
+	}
+
+	logger.Info("legacy password hash was upgraded")
 }
 
 // error is helper method to render any errors during work of handlers
@@ -2,22 +2,28 @@ package apiserver
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/gopherschool/http-rest-api/internal/app/blobstore"
 	"github.com/gopherschool/http-rest-api/internal/app/models"
 	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"github.com/stretchr/testify/assert"
+	"image"
+	"image/png"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 )
 
 func TestServer_AuthenticateUser(t *testing.T) {
+	ctx := context.Background()
 	store := teststore.NewStore()
 	u := models.TestUser(t)
-	store.User().Create(u)
+	store.User().Create(ctx, u)
 
 	testCases := []struct {
 		name         string
@@ -78,6 +84,14 @@ func TestServerHandleUsersCreate(t *testing.T) {
 			},
 			expectedCode: http.StatusCreated, // see handleUsersCreate() in server.go
 		},
+		{
+			name: "duplicate email",
+			payload: map[string]string{
+				"email":    "user@example.org",
+				"password": "password",
+			},
+			expectedCode: http.StatusConflict, // user from previous case already exists
+		},
 		{
 			name:         "invalid payload",
 			payload:      "invalid_payload",
@@ -111,9 +125,10 @@ func TestServerHandleUsersCreate(t *testing.T) {
 }
 
 func TestServerHandleSessionsCreate(t *testing.T) {
+	ctx := context.Background()
 	u := models.TestUser(t)
 	store := teststore.NewStore()
-	store.User().Create(u)
+	store.User().Create(ctx, u)
 	s := newServer(store, sessions.NewCookieStore([]byte("random_secret")))
 	testCases := []struct {
 		name         string
@@ -164,3 +179,236 @@ func TestServerHandleSessionsCreate(t *testing.T) {
 		})
 	}
 }
+
+func TestServerHandleSessionsCreate_RehashLegacyPassword(t *testing.T) {
+	ctx := context.Background()
+	store := teststore.NewStore()
+	u := &models.User{
+		Email:             "legacy@example.org",
+		EncryptedPassword: "sha1$a1b2$33f40cdfea64983c20fc624ca2df455a11e8338a", // sha1("a1b2" + "password")
+	}
+	assert.NoError(t, store.User().Create(ctx, u))
+	s := newServer(store, sessions.NewCookieStore([]byte("random_secret")))
+
+	b := &bytes.Buffer{}
+	json.NewEncoder(b).Encode(map[string]string{"email": u.Email, "password": "password"})
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/sessions", b)
+	s.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// legacy hash was replaced by bcrypt one and still matches the password
+	stored, err := store.User().FindByID(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.False(t, stored.NeedsRehash())
+	assert.True(t, stored.ComparePasswords("password"))
+}
+
+func TestServerHandleUsersSearch(t *testing.T) {
+	ctx := context.Background()
+	store := teststore.NewStore()
+	admin := models.TestUser(t)
+	admin.Email = "admin@example.org"
+	admin.IsAdmin = true
+	store.User().Create(ctx, admin)
+	u := models.TestUser(t)
+	u.Email = "john.smith@example.org"
+	store.User().Create(ctx, u)
+
+	secretKey := []byte("secret")
+	s := newServer(store, sessions.NewCookieStore(secretKey))
+	sc := securecookie.New(secretKey, nil)
+
+	testCases := []struct {
+		name         string
+		userID       int
+		query        string
+		expectedCode int
+		expectedLen  int
+	}{
+		{
+			name:         "admin",
+			userID:       admin.ID,
+			query:        "?q=smith",
+			expectedCode: http.StatusOK,
+			expectedLen:  1,
+		},
+		{
+			name:         "pagination",
+			userID:       admin.ID,
+			query:        "?q=example&limit=1&offset=1",
+			expectedCode: http.StatusOK,
+			expectedLen:  1,
+		},
+		{
+			name:         "empty query",
+			userID:       admin.ID,
+			query:        "",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid limit",
+			userID:       admin.ID,
+			query:        "?q=smith&limit=-1",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not admin",
+			userID:       u.ID,
+			query:        "?q=smith",
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/admin/users/search"+tc.query, nil)
+			cookieStr, _ := sc.Encode(sessionName, map[interface{}]interface{}{"user_id": tc.userID})
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", sessionName, cookieStr))
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+
+			if tc.expectedCode == http.StatusOK {
+				res := struct {
+					Users []*models.User `json:"users"`
+				}{}
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+				assert.Len(t, res.Users, tc.expectedLen)
+			}
+		})
+	}
+}
+
+// setSession attaches session cookie of the user to request
+func setSession(t *testing.T, req *http.Request, secretKey []byte, userID int) {
+	t.Helper()
+
+	cookieStr, err := securecookie.New(secretKey, nil).Encode(sessionName, map[interface{}]interface{}{"user_id": userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Cookie", fmt.Sprintf("%s=%s", sessionName, cookieStr))
+}
+
+func TestServerHandleAvatarUpload(t *testing.T) {
+	ctx := context.Background()
+	store := teststore.NewStore()
+	u := models.TestUser(t)
+	store.User().Create(ctx, u)
+
+	secretKey := []byte("secret")
+	s := newServer(store, sessions.NewCookieStore(secretKey))
+	blobs, err := blobstore.NewLocalStore(t.TempDir(), "/uploads")
+	assert.NoError(t, err)
+	s.blobStore = blobs
+	s.avatarMaxSize = 1 << 10
+
+	pngData := &bytes.Buffer{}
+	assert.NoError(t, png.Encode(pngData, image.NewGray(image.Rect(0, 0, 10, 10))))
+
+	multipartBody := &bytes.Buffer{}
+	mw := multipart.NewWriter(multipartBody)
+	fw, _ := mw.CreateFormFile("avatar", "avatar.png")
+	fw.Write(pngData.Bytes())
+	mw.Close()
+
+	largeMultipartBody := &bytes.Buffer{}
+	largeMW := multipart.NewWriter(largeMultipartBody)
+	fw, _ = largeMW.CreateFormFile("avatar", "avatar.png")
+	fw.Write(make([]byte, 4<<10))
+	largeMW.Close()
+
+	testCases := []struct {
+		name         string
+		contentType  string
+		body         []byte
+		ifMatch      string
+		expectedCode int
+	}{
+		{
+			name:         "raw image",
+			contentType:  "image/png",
+			body:         pngData.Bytes(),
+			ifMatch:      `"1"`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "multipart",
+			contentType:  mw.FormDataContentType(),
+			body:         multipartBody.Bytes(),
+			ifMatch:      `"2"`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "not an image",
+			contentType:  "image/png",
+			body:         []byte("hello"),
+			ifMatch:      `"3"`,
+			expectedCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:         "too large",
+			contentType:  "image/png",
+			body:         make([]byte, 2<<10),
+			ifMatch:      `"3"`,
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:         "too large multipart",
+			contentType:  largeMW.FormDataContentType(),
+			body:         largeMultipartBody.Bytes(),
+			ifMatch:      `"3"`,
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:         "without If-Match",
+			contentType:  "image/png",
+			body:         pngData.Bytes(),
+			expectedCode: http.StatusPreconditionRequired,
+		},
+		{
+			name:         "stale ETag",
+			contentType:  "image/png",
+			body:         pngData.Bytes(),
+			ifMatch:      `"1"`,
+			expectedCode: http.StatusPreconditionFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPut, "/private/users/me/avatar", bytes.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+			setSession(t, req, secretKey, u.ID)
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+
+			if tc.expectedCode == http.StatusOK {
+				res := &models.User{}
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(res))
+				assert.Contains(t, res.AvatarURL, "/uploads/avatars/")
+				assert.NotEmpty(t, rec.Header().Get("ETag"))
+			}
+		})
+	}
+
+	// thumbnails are served by the server itself
+	s.serveBlobs("/uploads", blobs)
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/uploads/avatars/"+fmt.Sprint(u.ID)+"/64.png", nil)
+	s.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// nothing but avatars is served, even if it's in the store
+	assert.NoError(t, blobs.Put("exports/1/1.zip", bytes.NewReader([]byte("personal data")), "application/zip"))
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/uploads/exports/1/1.zip", nil)
+	s.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,226 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// certCheckInterval is how often certificate files are checked for changes.
+// SIGHUP reloads them at once, e.g. right after renewal
+const certCheckInterval = 30 * time.Second
+
+// tlsVersions maps values of Config.TLSMinVersion to crypto/tls constants
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig returns TLS config which takes certificates from reloader
+func newTLSConfig(config *Config, reloader *certReloader) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[config.TLSMinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unknown tls_min_version %q", config.TLSMinVersion)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if config.TLSClientCAFile != "" {
+		pool, err := loadCertPool(config.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		// certificates are optional: browsers log in with the session cookie,
+		// but a certificate which is given must be signed by one of the CAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		tlsConfig.ClientCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// loadCertPool reads PEM bundle of CA certificates. The bundle is read once, changing it requires restart
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no certificates found", path)
+	}
+
+	return pool, nil
+}
+
+// certReloader keeps certificate and key loaded from files and reloads them when the files change,
+// so renewed certificates are used without restart. Established connections keep the old certificate
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time // the latest modification time of both files
+}
+
+// newCertReloader loads certificate at once, so invalid files prevent start
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// reload loads files even if they are not changed. Broken files leave the previous certificate in use
+func (r *certReloader) reload() error {
+	modTime, err := r.filesModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// reloadIfChanged reloads files if any of them is modified after the last load
+func (r *certReloader) reloadIfChanged() (bool, error) {
+	modTime, err := r.filesModTime()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	changed := !modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	return true, r.reload()
+}
+
+func (r *certReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// watch reloads certificate on every signal from hup and when files change, until ctx is done
+func (r *certReloader) watch(ctx context.Context, interval time.Duration, hup <-chan os.Signal, logger logrus.FieldLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := r.reload(); err != nil {
+				logger.Errorf("failed to reload TLS certificate, the previous one is used: %v", err)
+				continue
+			}
+
+			logger.Info("TLS certificate is reloaded")
+		case <-ticker.C:
+			changed, err := r.reloadIfChanged()
+			if err != nil {
+				logger.Errorf("failed to reload TLS certificate, the previous one is used: %v", err)
+				continue
+			}
+
+			if changed {
+				logger.Info("TLS certificate is reloaded")
+			}
+		}
+	}
+}
+
+// newRedirectServer returns plain HTTP server on HTTPRedirectAddr which redirects everything to HTTPS on BindAddr
+func newRedirectServer(config *Config) (*http.Server, error) {
+	_, tlsPort, err := net.SplitHostPort(config.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Server{
+		Addr:              config.HTTPRedirectAddr,
+		Handler:           redirectToHTTPS(tlsPort),
+		ReadHeaderTimeout: config.ReadHeaderTimeout.Duration,
+		ReadTimeout:       config.ReadTimeout.Duration,
+		WriteTimeout:      config.WriteTimeout.Duration,
+		IdleTimeout:       config.IdleTimeout.Duration,
+	}, nil
+}
+
+// redirectToHTTPS redirects to the same host and path on tlsPort. GET and HEAD get 301,
+// other methods get 308, so clients repeat them with the same method and body
+func redirectToHTTPS(tlsPort string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		} else {
+			// no port, IPv6 is still in brackets
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+
+		if tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		code := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	}
+}
@@ -0,0 +1,381 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
+)
+
+// writeCert saves self-signed certificate for commonName to dir and sets modification time of the files
+func writeCert(t *testing.T, dir, commonName string, modTime time.Time) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{commonName},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	for name, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(name, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return certFile, keyFile
+}
+
+// commonName returns subject of the certificate which reloader gives to new connections
+func commonName(t *testing.T, r *certReloader) string {
+	t.Helper()
+
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	certFile, keyFile := writeCert(t, dir, "first.example.org", now.Add(-time.Hour))
+	r, err := newCertReloader(certFile, keyFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "first.example.org", commonName(t, r))
+
+	changed, err := r.reloadIfChanged()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	writeCert(t, dir, "second.example.org", now)
+	changed, err = r.reloadIfChanged()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "second.example.org", commonName(t, r))
+
+	// broken files don't replace working certificate
+	assert.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0o600))
+	assert.Error(t, r.reload())
+	assert.Equal(t, "second.example.org", commonName(t, r))
+
+	// SIGHUP reloads files even with the same modification time
+	writeCert(t, dir, "third.example.org", now)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hup := make(chan os.Signal, 1)
+	go r.watch(ctx, time.Hour, hup, logrus.New())
+	hup <- syscall.SIGHUP
+	assert.Eventually(t, func() bool {
+		return commonName(t, r) == "third.example.org"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "example.org", time.Now())
+	r, err := newCertReloader(certFile, keyFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	config := NewConfig()
+	tlsConfig, err := newTLSConfig(config, r)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+
+	config.TLSMinVersion = "1.4"
+	_, err = newTLSConfig(config, r)
+	assert.Error(t, err)
+
+	config = NewConfig()
+	config.TLSClientCAFile = certFile
+	tlsConfig, err = newTLSConfig(config, r)
+	assert.NoError(t, err)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, tlsConfig.ClientAuth)
+	assert.NotNil(t, tlsConfig.ClientCAs)
+
+	config.TLSClientCAFile = keyFile
+	_, err = newTLSConfig(config, r)
+	assert.Error(t, err)
+}
+
+// testCA signs client certificates in tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCA creates CA and saves its certificate to caFile
+func newTestCA(t *testing.T, caFile string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns client certificate with subject and DNS names signed by ca
+func (ca *testCA) issue(t *testing.T, subject pkix.Name, dnsNames ...string) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     dnsNames,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestServerAuthenticateUser_ClientCertificate(t *testing.T) {
+	ctx := context.Background()
+	store := teststore.NewStore()
+	billing := models.TestUser(t)
+	billing.Email = "billing@example.org"
+	store.User().Create(ctx, billing)
+	store.User().AddCertificateSubject(ctx, billing.ID, "dn:CN=billing,O=Acme")
+	reports := models.TestUser(t)
+	reports.Email = "reports@example.org"
+	store.User().Create(ctx, reports)
+	store.User().AddCertificateSubject(ctx, reports.ID, "dns:reports.internal")
+
+	dir := t.TempDir()
+	config := NewConfig()
+	config.TLSCertFile, config.TLSKeyFile = writeCert(t, dir, "127.0.0.1", time.Now())
+	config.TLSClientCAFile = filepath.Join(dir, "ca.pem")
+	ca := newTestCA(t, config.TLSClientCAFile)
+	otherCA := newTestCA(t, filepath.Join(dir, "other-ca.pem"))
+
+	r, err := newCertReloader(config.TLSCertFile, config.TLSKeyFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tlsConfig, err := newTLSConfig(config, r)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ts := httptest.NewUnstartedServer(newServer(store, sessions.NewCookieStore([]byte("secret"))))
+	ts.TLS = tlsConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	testCases := []struct {
+		name          string
+		certs         []tls.Certificate
+		expectedCode  int
+		expectedEmail string
+	}{
+		{
+			name:          "subject",
+			certs:         []tls.Certificate{ca.issue(t, pkix.Name{CommonName: "billing", Organization: []string{"Acme"}})},
+			expectedCode:  http.StatusOK,
+			expectedEmail: "billing@example.org",
+		},
+		{
+			name:          "DNS name",
+			certs:         []tls.Certificate{ca.issue(t, pkix.Name{CommonName: "reports"}, "reports.internal")},
+			expectedCode:  http.StatusOK,
+			expectedEmail: "reports@example.org",
+		},
+		{
+			// DNS name which looks like the DN of billing must not authenticate as billing
+			name:         "SAN of another type",
+			certs:        []tls.Certificate{ca.issue(t, pkix.Name{CommonName: "spoofed"}, "CN=billing,O=Acme")},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "not mapped",
+			certs:        []tls.Certificate{ca.issue(t, pkix.Name{CommonName: "unknown"}, "unknown.internal")},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "without certificate",
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				Certificates:       tc.certs,
+			}}}
+			res, err := client.Get(ts.URL + "/private/whoami")
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tc.expectedCode, res.StatusCode)
+			if tc.expectedEmail != "" {
+				u := &models.User{}
+				assert.NoError(t, json.NewDecoder(res.Body).Decode(u))
+				assert.Equal(t, tc.expectedEmail, u.Email)
+			}
+		})
+	}
+
+	// certificate of another CA is rejected by TLS layer even if its subject is mapped
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{otherCA.issue(t, pkix.Name{CommonName: "billing", Organization: []string{"Acme"}})},
+	}}}
+	_, err = client.Get(ts.URL + "/private/whoami")
+	assert.Error(t, err)
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	testCases := []struct {
+		name             string
+		tlsPort          string
+		method           string
+		target           string
+		expectedCode     int
+		expectedLocation string
+	}{
+		{
+			name:             "default port",
+			tlsPort:          "443",
+			method:           http.MethodGet,
+			target:           "http://example.org/private/whoami?x=1",
+			expectedCode:     http.StatusMovedPermanently,
+			expectedLocation: "https://example.org/private/whoami?x=1",
+		},
+		{
+			name:             "custom port",
+			tlsPort:          "8443",
+			method:           http.MethodGet,
+			target:           "http://example.org:8080/healthz",
+			expectedCode:     http.StatusMovedPermanently,
+			expectedLocation: "https://example.org:8443/healthz",
+		},
+		{
+			name:             "post keeps method",
+			tlsPort:          "443",
+			method:           http.MethodPost,
+			target:           "http://example.org/sessions",
+			expectedCode:     http.StatusPermanentRedirect,
+			expectedLocation: "https://example.org/sessions",
+		},
+		{
+			name:             "IPv6",
+			tlsPort:          "443",
+			method:           http.MethodGet,
+			target:           "http://[::1]/healthz",
+			expectedCode:     http.StatusMovedPermanently,
+			expectedLocation: "https://[::1]/healthz",
+		},
+		{
+			name:             "IPv6 with custom port",
+			tlsPort:          "8443",
+			method:           http.MethodGet,
+			target:           "http://[::1]:8080/healthz",
+			expectedCode:     http.StatusMovedPermanently,
+			expectedLocation: "https://[::1]:8443/healthz",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			redirectToHTTPS(tc.tlsPort)(rec, httptest.NewRequest(tc.method, tc.target, nil))
+			assert.Equal(t, tc.expectedCode, rec.Code)
+			assert.Equal(t, tc.expectedLocation, rec.Header().Get("Location"))
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+var (
+	errPreconditionRequired    = errors.New("If-Match header with ETag of the user is required")
+	errPreconditionFailed      = errors.New("user was changed by someone else, load it again")
+	errCurrentPasswordRequired = errors.New("current password is required to change email or password")
+	errInvalidUserID           = errors.New("invalid user id")
+	errUserNotFound            = errors.New("user not found")
+)
+
+// userETag changes with every update of user, see models.User.Version
+func userETag(u *models.User) string {
+	return `"` + strconv.Itoa(u.Version) + `"`
+}
+
+// checkIfMatch makes sure that client has seen the current version of user before changing it.
+// Returns errPreconditionRequired if there is no If-Match header with ETag ("*" doesn't prove
+// that client has seen the user) and errPreconditionFailed if ETag doesn't match
+func checkIfMatch(r *http.Request, u *models.User) error {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return errPreconditionRequired
+	}
+
+	etag := userETag(u)
+	for _, v := range strings.Split(header, ",") {
+		if strings.TrimSpace(v) == etag {
+			return nil
+		}
+	}
+
+	return errPreconditionFailed
+}
+
+// preconditionError renders error of checkIfMatch
+func (s *server) preconditionError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == errPreconditionRequired {
+		s.error(w, r, http.StatusPreconditionRequired, err)
+		return
+	}
+
+	s.error(w, r, http.StatusPreconditionFailed, err)
+}
+
+// respondUser renders user with its ETag
+func (s *server) respondUser(w http.ResponseWriter, r *http.Request, code int, u *models.User) {
+	u.Sanitize()
+	w.Header().Set("ETag", userETag(u))
+	s.respond(w, r, code, u)
+}
+
+// updateUser saves user and renders either the result or error of the store
+func (s *server) updateUser(w http.ResponseWriter, r *http.Request, u *models.User) {
+	if err := u.Validate(); err != nil {
+		s.error(w, r, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	if err := u.BeforeUpdate(); err != nil {
+		s.error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := s.store.User().Update(r.Context(), u); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			// changed between If-Match check and update
+			s.error(w, r, http.StatusPreconditionFailed, errPreconditionFailed)
+		case errors.Is(err, store.ErrDuplicate):
+			s.error(w, r, http.StatusConflict, errEmailAlreadyTaken)
+		case errors.Is(err, store.ErrRecordNotFound):
+			s.error(w, r, http.StatusNotFound, errUserNotFound)
+		default:
+			s.error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	s.respondUser(w, r, http.StatusOK, u)
+}
+
+// handleUsersUpdateMe changes email or password of authenticated user. Both need the current password,
+// so a stolen session is not enough to take over the account
+func (s *server) handleUsersUpdateMe() http.HandlerFunc {
+	type request struct {
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := r.Context().Value(ctxKeyUser).(*models.User)
+		if err := checkIfMatch(r, current); err != nil {
+			s.preconditionError(w, r, err)
+			return
+		}
+
+		req := &request{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if (req.Email != nil || req.Password != nil) && !current.ComparePasswords(req.CurrentPassword) {
+			s.error(w, r, http.StatusForbidden, errCurrentPasswordRequired)
+			return
+		}
+
+		// changes are made on a copy, the user in context must stay as it's stored
+		u := *current
+		if req.Email != nil {
+			u.Email = *req.Email
+		}
+
+		if req.Password != nil {
+			u.Password = *req.Password
+		}
+
+		s.updateUser(w, r, &u)
+	}
+}
+
+// handleAdminUsersGet renders any user for admins
+func (s *server) handleAdminUsersGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := s.findUser(w, r)
+		if !ok {
+			return
+		}
+
+		s.respondUser(w, r, http.StatusOK, u)
+	}
+}
+
+// handleAdminUsersUpdate lets admins change email and admin flag of any user
+func (s *server) handleAdminUsersUpdate() http.HandlerFunc {
+	type request struct {
+		Email   *string `json:"email"`
+		IsAdmin *bool   `json:"is_admin"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		found, ok := s.findUser(w, r)
+		if !ok {
+			return
+		}
+
+		if err := checkIfMatch(r, found); err != nil {
+			s.preconditionError(w, r, err)
+			return
+		}
+
+		req := &request{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		u := *found
+		if req.Email != nil {
+			u.Email = *req.Email
+		}
+
+		if req.IsAdmin != nil {
+			u.IsAdmin = *req.IsAdmin
+		}
+
+		s.updateUser(w, r, &u)
+	}
+}
+
+// findUser loads user from {id} in URL
+func (s *server) findUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.error(w, r, http.StatusBadRequest, errInvalidUserID)
+		return nil, false
+	}
+
+	u, err := s.store.User().FindByID(r.Context(), id)
+	if err != nil {
+		if err == store.ErrRecordNotFound {
+			s.error(w, r, http.StatusNotFound, errUserNotFound)
+			return nil, false
+		}
+
+		s.error(w, r, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	return u, true
+}
@@ -0,0 +1,178 @@
+package apiserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
+)
+
+func TestServerHandleUsersUpdate(t *testing.T) {
+	ctx := context.Background()
+	store := teststore.NewStore()
+	u := models.TestUser(t)
+	store.User().Create(ctx, u)
+	admin := models.TestUser(t)
+	admin.Email = "admin@example.org"
+	admin.IsAdmin = true
+	store.User().Create(ctx, admin)
+
+	secretKey := []byte("secret")
+	s := newServer(store, sessions.NewCookieStore(secretKey))
+
+	do := func(userID int, method, url, ifMatch string, payload interface{}) *httptest.ResponseRecorder {
+		b := &bytes.Buffer{}
+		if payload != nil {
+			json.NewEncoder(b).Encode(payload)
+		}
+
+		req, _ := http.NewRequest(method, url, b)
+		setSession(t, req, secretKey, userID)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(u.ID, http.MethodGet, "/private/whoami", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	etag := rec.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+
+	testCases := []struct {
+		name         string
+		userID       int
+		method       string
+		url          string
+		ifMatch      string
+		payload      interface{}
+		expectedCode int
+	}{
+		{
+			name:         "without If-Match",
+			userID:       u.ID,
+			method:       http.MethodPatch,
+			url:          "/private/users/me",
+			payload:      map[string]string{"email": "new@example.org", "current_password": "password"},
+			expectedCode: http.StatusPreconditionRequired,
+		},
+		{
+			name:         "If-Match any",
+			userID:       u.ID,
+			method:       http.MethodPatch,
+			url:          "/private/users/me",
+			ifMatch:      "*",
+			payload:      map[string]string{"email": "new@example.org", "current_password": "password"},
+			expectedCode: http.StatusPreconditionRequired,
+		},
+		{
+			name:         "stale ETag",
+			userID:       u.ID,
+			method:       http.MethodPatch,
+			url:          "/private/users/me",
+			ifMatch:      `"7"`,
+			payload:      map[string]string{"email": "new@example.org", "current_password": "password"},
+			expectedCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:         "without current password",
+			userID:       u.ID,
+			method:       http.MethodPatch,
+			url:          "/private/users/me",
+			ifMatch:      etag,
+			payload:      map[string]string{"email": "new@example.org"},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "email of another user",
+			userID:       u.ID,
+			method:       http.MethodPatch,
+			url:          "/private/users/me",
+			ifMatch:      etag,
+			payload:      map[string]string{"email": "admin@example.org", "current_password": "password"},
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:         "invalid email",
+			userID:       u.ID,
+			method:       http.MethodPatch,
+			url:          "/private/users/me",
+			ifMatch:      etag,
+			payload:      map[string]string{"email": "invalid", "current_password": "password"},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "valid",
+			userID:       u.ID,
+			method:       http.MethodPatch,
+			url:          "/private/users/me",
+			ifMatch:      etag,
+			payload:      map[string]string{"email": "New@Example.org", "current_password": "password"},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "admin endpoint for not admin",
+			userID:       u.ID,
+			method:       http.MethodGet,
+			url:          fmt.Sprintf("/admin/users/%d", u.ID),
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "admin get",
+			userID:       admin.ID,
+			method:       http.MethodGet,
+			url:          fmt.Sprintf("/admin/users/%d", u.ID),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "admin get unknown user",
+			userID:       admin.ID,
+			method:       http.MethodGet,
+			url:          "/admin/users/100",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "admin update with ETag from before the user's update",
+			userID:       admin.ID,
+			method:       http.MethodPatch,
+			url:          fmt.Sprintf("/admin/users/%d", u.ID),
+			ifMatch:      etag,
+			payload:      map[string]bool{"is_admin": true},
+			expectedCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:         "admin update",
+			userID:       admin.ID,
+			method:       http.MethodPatch,
+			url:          fmt.Sprintf("/admin/users/%d", u.ID),
+			ifMatch:      `"2"`,
+			payload:      map[string]bool{"is_admin": true},
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := do(tc.userID, tc.method, tc.url, tc.ifMatch, tc.payload)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+		})
+	}
+
+	found, err := store.User().FindByID(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "new@example.org", found.Email)
+	assert.True(t, found.IsAdmin)
+	assert.Equal(t, 3, found.Version)
+}
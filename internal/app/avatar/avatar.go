@@ -0,0 +1,132 @@
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register decoders for image.Decode
+	_ "image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// Sizes of generated thumbnails in pixels. Every thumbnail is a square
+var Sizes = []int{64, 256}
+
+// LargeSize is the thumbnail rendered as user's avatar_url
+const LargeSize = 256
+
+// ContentType of all generated thumbnails
+const ContentType = "image/png"
+
+// maxDimension protects from "decompression bombs": small files with huge pictures inside
+const maxDimension = 4096
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format, use PNG, JPEG or GIF")
+	ErrTooLarge          = errors.New("image is too large")
+)
+
+var allowedContentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// KeyPrefix is common for keys of all thumbnails
+const KeyPrefix = "avatars/"
+
+// Key returns blob key of user's thumbnail of the given size.
+// Keys don't change between uploads, so a new avatar replaces the old one
+func Key(userID, size int) string {
+	return fmt.Sprintf(KeyPrefix+"%d/%d.png", userID, size)
+}
+
+// Thumbnails decodes uploaded image and returns PNG encoded thumbnails for all Sizes.
+// Type of the image is detected by its content, not by what client says
+func Thumbnails(data []byte) (map[int][]byte, error) {
+	if !allowedContentTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedFormat
+	}
+
+	// check dimensions before decoding the whole image
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Width > maxDimension || cfg.Height > maxDimension {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	thumbs := make(map[int][]byte, len(Sizes))
+	for _, size := range Sizes {
+		b := &bytes.Buffer{}
+		if err := png.Encode(b, thumbnail(img, size)); err != nil {
+			return nil, err
+		}
+
+		thumbs[size] = b.Bytes()
+	}
+
+	return thumbs, nil
+}
+
+// thumbnail crops the biggest square from the center of src and scales it to size x size.
+// Every destination pixel is an average of source pixels it covers (box filter),
+// which is good enough for downscaling avatars and doesn't need any dependencies
+func thumbnail(src image.Image, size int) *image.RGBA {
+	b := src.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		sy0, sy1 := scaleRange(y, size, side)
+		for x := 0; x < size; x++ {
+			sx0, sx1 := scaleRange(x, size, side)
+
+			var r, g, bl, a, n uint64
+			for sy := y0 + sy0; sy < y0+sy1; sy++ {
+				for sx := x0 + sx0; sx < x0+sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
+
+// scaleRange returns source pixels [from, to) which destination pixel i covers.
+// At least one pixel is returned, so small images are upscaled
+func scaleRange(i, dstSize, srcSize int) (from, to int) {
+	from = i * srcSize / dstSize
+	to = (i + 1) * srcSize / dstSize
+	if to <= from {
+		to = from + 1
+	}
+
+	return from, to
+}
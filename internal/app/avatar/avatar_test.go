@@ -0,0 +1,74 @@
+package avatar_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/avatar"
+)
+
+func TestThumbnails(t *testing.T) {
+	testCases := []struct {
+		name   string
+		width  int
+		height int
+		encode func(*bytes.Buffer, image.Image) error
+	}{
+		{
+			name:   "landscape png",
+			width:  400,
+			height: 300,
+			encode: func(b *bytes.Buffer, img image.Image) error { return png.Encode(b, img) },
+		},
+		{
+			name:   "small jpeg is upscaled",
+			width:  20,
+			height: 30,
+			encode: func(b *bytes.Buffer, img image.Image) error { return jpeg.Encode(b, img, nil) },
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			img := image.NewRGBA(image.Rect(0, 0, tc.width, tc.height))
+			for x := 0; x < tc.width; x++ {
+				for y := 0; y < tc.height; y++ {
+					img.Set(x, y, color.RGBA{R: 200, A: 255})
+				}
+			}
+
+			b := &bytes.Buffer{}
+			assert.NoError(t, tc.encode(b, img))
+
+			thumbs, err := avatar.Thumbnails(b.Bytes())
+			assert.NoError(t, err)
+			assert.Len(t, thumbs, len(avatar.Sizes))
+			for _, size := range avatar.Sizes {
+				thumb, err := png.Decode(bytes.NewReader(thumbs[size]))
+				assert.NoError(t, err)
+				assert.Equal(t, image.Rect(0, 0, size, size), thumb.Bounds())
+			}
+		})
+	}
+}
+
+func TestThumbnails_Invalid(t *testing.T) {
+	_, err := avatar.Thumbnails([]byte("definitely not an image"))
+	assert.ErrorIs(t, err, avatar.ErrUnsupportedFormat)
+
+	// only header is checked for dimensions, so the image doesn't have to be really big
+	b := &bytes.Buffer{}
+	assert.NoError(t, png.Encode(b, image.NewGray(image.Rect(0, 0, 5000, 1))))
+	_, err = avatar.Thumbnails(b.Bytes())
+	assert.ErrorIs(t, err, avatar.ErrTooLarge)
+}
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, "avatars/42/256.png", avatar.Key(42, 256))
+}
@@ -0,0 +1,24 @@
+package blobstore
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// BlobStore keeps files (avatars, exports etc.) outside of the database.
+// Keys look like relative paths: "avatars/42/256.png"
+type BlobStore interface {
+	// Put creates or replaces blob with content from r
+	Put(key string, r io.Reader, contentType string) error
+	// Open returns blob content, ErrNotFound if there is no such blob
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes blob, it's not an error if blob doesn't exist
+	Delete(key string) error
+	// URL is a public link to the blob which can be rendered to clients
+	URL(key string) string
+}
@@ -0,0 +1,54 @@
+package blobstore_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/blobstore"
+)
+
+func TestLocalStore(t *testing.T) {
+	s, err := blobstore.NewLocalStore(t.TempDir(), "/uploads/")
+	assert.NoError(t, err)
+
+	key := "avatars/1/64.png"
+	_, err = s.Open(key)
+	assert.ErrorIs(t, err, blobstore.ErrNotFound)
+
+	assert.NoError(t, s.Put(key, strings.NewReader("content"), "image/png"))
+	f, err := s.Open(key)
+	assert.NoError(t, err)
+	b, _ := io.ReadAll(f)
+	f.Close()
+	assert.Equal(t, "content", string(b))
+	assert.Equal(t, "/uploads/avatars/1/64.png", s.URL(key))
+
+	// blobs can be served over HTTP, but directories can't be listed
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/avatars/1/64.png", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "content", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/avatars/1/", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	assert.NoError(t, s.Delete(key))
+	assert.NoError(t, s.Delete(key)) // deleting twice is fine
+	_, err = s.Open(key)
+	assert.ErrorIs(t, err, blobstore.ErrNotFound)
+}
+
+func TestLocalStore_InvalidKey(t *testing.T) {
+	s, err := blobstore.NewLocalStore(t.TempDir(), "/uploads")
+	assert.NoError(t, err)
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "a/../../outside", "a//b"} {
+		assert.ErrorIs(t, s.Put(key, strings.NewReader(""), ""), blobstore.ErrInvalidKey, key)
+	}
+}
@@ -0,0 +1,109 @@
+// Package fixtures seeds a store with users, organizations and their members from a TOML or JSON file.
+// It's meant for the memory store, so frontend developers get a working backend without a database
+package fixtures
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// Fixtures is the content of fixtures file. Members refer to users by email, so users must be listed too
+type Fixtures struct {
+	Users         []User         `toml:"users" json:"users"`
+	Organizations []Organization `toml:"organizations" json:"organizations"`
+}
+
+type User struct {
+	Email    string `toml:"email" json:"email"`
+	Password string `toml:"password" json:"password"`
+	IsAdmin  bool   `toml:"is_admin" json:"is_admin"`
+	// CertificateSubjects are typed client certificate names which authenticate as the user, e.g. "dn:CN=billing"
+	CertificateSubjects []string `toml:"certificate_subjects" json:"certificate_subjects"`
+}
+
+type Organization struct {
+	Name    string   `toml:"name" json:"name"`
+	Members []Member `toml:"members" json:"members"`
+}
+
+type Member struct {
+	Email string `toml:"email" json:"email"`
+	Role  string `toml:"role" json:"role"`
+}
+
+// Load reads fixtures from path. Files with .json extension are JSON, everything else is TOML
+func Load(path string) (*Fixtures, error) {
+	f := &Fixtures{}
+	if filepath.Ext(path) == ".json" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(data, f); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		return f, nil
+	}
+
+	if _, err := toml.DecodeFile(path, f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return f, nil
+}
+
+// Apply saves fixtures to s in one transaction, so invalid fixtures leave nothing behind.
+// Errors name the entity which can't be saved
+func Apply(ctx context.Context, s store.Store, f *Fixtures) error {
+	return s.WithTx(ctx, nil, func(tx store.Store) error {
+		userIDs := make(map[string]int, len(f.Users))
+		for _, fu := range f.Users {
+			u := &models.User{Email: fu.Email, Password: fu.Password, IsAdmin: fu.IsAdmin}
+			if err := tx.User().Create(ctx, u); err != nil {
+				return fmt.Errorf("user %s: %w", fu.Email, err)
+			}
+
+			for _, subject := range fu.CertificateSubjects {
+				if err := tx.User().AddCertificateSubject(ctx, u.ID, subject); err != nil {
+					return fmt.Errorf("user %s: certificate %s: %w", fu.Email, subject, err)
+				}
+			}
+
+			userIDs[models.NormalizeEmail(u.Email)] = u.ID
+		}
+
+		for _, fo := range f.Organizations {
+			o := &models.Organization{Name: fo.Name}
+			if err := tx.Organization().Create(ctx, o); err != nil {
+				return fmt.Errorf("organization %s: %w", fo.Name, err)
+			}
+
+			for _, fm := range fo.Members {
+				userID, ok := userIDs[models.NormalizeEmail(fm.Email)]
+				if !ok {
+					return fmt.Errorf("organization %s: member %s is not in users", fo.Name, fm.Email)
+				}
+
+				if err := tx.Membership().Create(ctx, &models.Membership{
+					OrganizationID: o.ID,
+					UserID:         userID,
+					Role:           fm.Role,
+				}); err != nil {
+					return fmt.Errorf("organization %s: member %s: %w", fo.Name, fm.Email, err)
+				}
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,112 @@
+package fixtures_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/fixtures"
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
+)
+
+func TestLoadAndApply(t *testing.T) {
+	testCases := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name: "toml",
+			file: "fixtures.toml",
+			content: `
+[[users]]
+email = "owner@example.org"
+password = "password"
+is_admin = true
+
+[[users]]
+email = "member@example.org"
+password = "password"
+certificate_subjects = ["dn:CN=member"]
+
+[[organizations]]
+name = "Acme"
+
+  [[organizations.members]]
+  email = "owner@example.org"
+  role = "owner"
+
+  [[organizations.members]]
+  email = "Member@Example.org"
+  role = "member"
+`,
+		},
+		{
+			name: "json",
+			file: "fixtures.json",
+			content: `{
+				"users": [
+					{"email": "owner@example.org", "password": "password", "is_admin": true},
+					{"email": "member@example.org", "password": "password", "certificate_subjects": ["dn:CN=member"]}
+				],
+				"organizations": [
+					{"name": "Acme", "members": [
+						{"email": "owner@example.org", "role": "owner"},
+						{"email": "Member@Example.org", "role": "member"}
+					]}
+				]
+			}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.file)
+			assert.NoError(t, os.WriteFile(path, []byte(tc.content), 0o600))
+
+			f, err := fixtures.Load(path)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			ctx := context.Background()
+			s := teststore.NewStore()
+			assert.NoError(t, fixtures.Apply(ctx, s, f))
+
+			owner, err := s.User().FindByEmail(ctx, "owner@example.org")
+			assert.NoError(t, err)
+			assert.True(t, owner.IsAdmin)
+			assert.True(t, owner.ComparePasswords("password"))
+
+			member, err := s.User().FindByCertificateSubject(ctx, "dn:CN=member")
+			assert.NoError(t, err)
+			assert.Equal(t, "member@example.org", member.Email)
+
+			members, err := s.Membership().ListByOrganization(ctx, 1)
+			assert.NoError(t, err)
+			assert.Len(t, members, 2)
+		})
+	}
+}
+
+func TestApply_Invalid(t *testing.T) {
+	ctx := context.Background()
+	s := teststore.NewStore()
+	err := fixtures.Apply(ctx, s, &fixtures.Fixtures{
+		Users: []fixtures.User{{Email: "owner@example.org", Password: "password"}},
+		Organizations: []fixtures.Organization{{
+			Name:    "Acme",
+			Members: []fixtures.Member{{Email: "unknown@example.org", Role: models.RoleOwner}},
+		}},
+	})
+	assert.EqualError(t, err, "organization Acme: member unknown@example.org is not in users")
+
+	// nothing is saved
+	_, err = s.User().FindByEmail(ctx, "owner@example.org")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+}
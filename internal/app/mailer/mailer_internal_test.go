@@ -0,0 +1,21 @@
+package mailer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildMessage(t *testing.T) {
+	b, err := buildMessage("noreply@example.org", Message{To: "user@example.org", Subject: "Hello", Body: "body"})
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "\r\nSubject: Hello\r\n")
+	assert.Contains(t, string(b), "\r\n\r\nbody")
+
+	b, err = buildMessage("noreply@example.org", Message{To: "user@example.org", Subject: "You are invited to Café", Body: "body"})
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "\r\nSubject: =?utf-8?q?You_are_invited_to_Caf=C3=A9?=\r\n")
+
+	_, err = buildMessage("noreply@example.org", Message{To: "user@example.org", Subject: "Hello\r\nBcc: other@example.org"})
+	assert.Error(t, err)
+}
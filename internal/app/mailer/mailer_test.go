@@ -0,0 +1,31 @@
+package mailer_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/mailer"
+)
+
+func TestLogMailer(t *testing.T) {
+	logger := logrus.New()
+	b := &bytes.Buffer{}
+	logger.Out = b
+
+	m := mailer.NewLogMailer(logger)
+	assert.NoError(t, m.Send(mailer.Message{To: "user@example.org", Subject: "Hello", Body: "secret link"}))
+	assert.Contains(t, b.String(), "user@example.org")
+	assert.NotContains(t, b.String(), "secret link")
+}
+
+func TestSMTPMailer_InvalidHeaders(t *testing.T) {
+	m, err := mailer.NewSMTPMailer("localhost:25", "", "", "noreply@example.org")
+	assert.NoError(t, err)
+	assert.Error(t, m.Send(mailer.Message{To: "user@example.org\r\nBcc: other@example.org", Subject: "Hello"}))
+
+	_, err = mailer.NewSMTPMailer("localhost", "", "", "noreply@example.org")
+	assert.Error(t, err)
+}
@@ -0,0 +1,388 @@
+// Package migrate applies versioned SQL migrations. Applied version is kept in schema_migrations table
+// in the same format as golang-migrate uses, so databases migrated by its CLI are picked up as is
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// lockID of postgres advisory lock, it keeps several instances started together
+// from running migrations at the same time
+const lockID = 7_365_273_498_211
+
+var (
+	ErrUnknownVersion = errors.New("unknown migration version")
+	ErrNoMigrations   = errors.New("no migrations found")
+)
+
+// DirtyError is returned when previous migration failed in the middle. It can happen only
+// with migrations applied by external tools, here every migration runs in a transaction
+type DirtyError struct {
+	Version uint
+}
+
+func (e *DirtyError) Error() string {
+	return fmt.Sprintf("database is dirty after failed migration %d, fix it manually", e.Version)
+}
+
+// Migration is a pair of scripts from files like 000001_create_users.up.sql and 000001_create_users.down.sql
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+var fileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load reads migrations from root of fsys ordered by version. Every migration must have both up and down files
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := fileRegexp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file name %q", entry.Name())
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("invalid version in migration file name %q", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[uint(version)]
+		if !ok {
+			m = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[m.Version] = m
+		}
+
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names: %q and %q", m.Version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	if len(byVersion) == 0 {
+		return nil, ErrNoMigrations
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d must have both up and down files", m.Version)
+		}
+
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator moves database schema between versions
+type Migrator struct {
+	db         *sql.DB
+	migrations []*Migration
+	noLock     bool
+}
+
+// New loads migrations from fsys, see Load
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// WithoutLock turns off postgres advisory lock for databases which don't have it.
+// SQLite doesn't need it: it's used by one process, and every migration takes the database write lock anyway
+func (m *Migrator) WithoutLock() *Migrator {
+	m.noLock = true
+	return m
+}
+
+// Latest returns version of the last known migration
+func (m *Migrator) Latest() uint {
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns currently applied version, zero if nothing is applied yet
+func (m *Migrator) Version(ctx context.Context) (uint, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return 0, err
+	}
+
+	return version(ctx, conn)
+}
+
+// AppliedVersion returns currently applied version like Version does, but never changes the database:
+// zero is returned if schema_migrations doesn't exist yet. It needs only SELECT privilege,
+// so it's used by health checks which run with connections of the server
+func (m *Migrator) AppliedVersion(ctx context.Context) (uint, error) {
+	v, err := version(ctx, m.db)
+	if err != nil && isMissingTable(err) {
+		return 0, nil
+	}
+
+	return v, err
+}
+
+// isMissingTable tells whether err is about a table which doesn't exist
+func isMissingTable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "42P01" // undefined_table
+	}
+
+	// SQLite has no specific code for it
+	return strings.Contains(err.Error(), "no such table")
+}
+
+// Status describes one migration for `migrate status`
+type Status struct {
+	*Migration
+	Applied bool
+}
+
+// Status lists all known migrations and whether they are applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	current, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = Status{Migration: migration, Applied: migration.Version <= current}
+	}
+
+	return statuses, nil
+}
+
+// Up applies all pending migrations and returns how many were applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	return m.To(ctx, m.Latest())
+}
+
+// Down reverts the last applied migration
+func (m *Migrator) Down(ctx context.Context) (int, error) {
+	var n int
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		current, err := version(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		i := m.index(current)
+		if i < 0 {
+			return nil
+		}
+
+		n, err = m.migrate(ctx, conn, current, m.previous(i))
+		return err
+	})
+
+	return n, err
+}
+
+// To applies or reverts migrations until the schema is at target version. Zero reverts everything
+func (m *Migrator) To(ctx context.Context, target uint) (int, error) {
+	if target != 0 && m.index(target) < 0 {
+		return 0, fmt.Errorf("%w: %d", ErrUnknownVersion, target)
+	}
+
+	var n int
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		current, err := version(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		n, err = m.migrate(ctx, conn, current, target)
+		return err
+	})
+
+	return n, err
+}
+
+// migrate does the job of To while the lock is held
+func (m *Migrator) migrate(ctx context.Context, conn *sql.Conn, current, target uint) (int, error) {
+	if current != 0 && m.index(current) < 0 {
+		// database is newer than this binary, better not to touch it
+		return 0, fmt.Errorf("%w: database is at version %d", ErrUnknownVersion, current)
+	}
+
+	n := 0
+	for _, migration := range m.migrations {
+		if migration.Version <= current || migration.Version > target {
+			continue
+		}
+
+		if err := apply(ctx, conn, migration.Up, migration.Version); err != nil {
+			return n, fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+		}
+
+		n++
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version > current || migration.Version <= target {
+			continue
+		}
+
+		if err := apply(ctx, conn, migration.Down, m.previous(i)); err != nil {
+			return n, fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+		}
+
+		n++
+	}
+
+	return n, nil
+}
+
+// index returns position of migration with version, -1 if there is no such migration
+func (m *Migrator) index(version uint) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// previous returns version which is left after migration i is reverted
+func (m *Migrator) previous(i int) uint {
+	if i == 0 {
+		return 0
+	}
+
+	return m.migrations[i-1].Version
+}
+
+// locked runs fn with advisory lock held. Advisory locks belong to a session,
+// so everything goes through one connection
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if !m.noLock {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+			return err
+		}
+		// ctx may be already cancelled here, but the lock must be released anyway
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+	}
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(
+		ctx,
+		"CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)",
+	)
+
+	return err
+}
+
+// querier is implemented by both *sql.DB and *sql.Conn
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// version reads applied version, the table is empty when nothing is applied
+func version(ctx context.Context, conn querier) (uint, error) {
+	var (
+		v     uint
+		dirty bool
+	)
+
+	err := conn.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&v, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if dirty {
+		return 0, &DirtyError{Version: v}
+	}
+
+	return v, nil
+}
+
+// apply runs script and saves the new version in one transaction, so a failed migration leaves nothing behind
+func apply(ctx context.Context, conn *sql.Conn, script string, newVersion uint) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		return err
+	}
+
+	if newVersion != 0 {
+		if _, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)",
+			newVersion,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,125 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/glebarez/go-sqlite"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/migrate"
+	"github.com/gopherschool/http-rest-api/migrations"
+)
+
+func TestLoad(t *testing.T) {
+	file := func(content string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(content)}
+	}
+
+	testCases := []struct {
+		name    string
+		fsys    fstest.MapFS
+		isValid bool
+	}{
+		{
+			name: "valid",
+			fsys: fstest.MapFS{
+				"000002_add_column.up.sql":   file("ALTER TABLE t ADD COLUMN c int;"),
+				"000002_add_column.down.sql": file("ALTER TABLE t DROP COLUMN c;"),
+				"000001_create_t.up.sql":     file("CREATE TABLE t (id int);"),
+				"000001_create_t.down.sql":   file("DROP TABLE t;"),
+			},
+			isValid: true,
+		},
+		{
+			name: "missing down",
+			fsys: fstest.MapFS{
+				"000001_create_t.up.sql": file("CREATE TABLE t (id int);"),
+			},
+			isValid: false,
+		},
+		{
+			name: "different names",
+			fsys: fstest.MapFS{
+				"000001_create_t.up.sql":   file("CREATE TABLE t (id int);"),
+				"000001_create_x.down.sql": file("DROP TABLE t;"),
+			},
+			isValid: false,
+		},
+		{
+			name: "unexpected file",
+			fsys: fstest.MapFS{
+				"create_t.sql": file("CREATE TABLE t (id int);"),
+			},
+			isValid: false,
+		},
+		{
+			name:    "empty",
+			fsys:    fstest.MapFS{},
+			isValid: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ms, err := migrate.Load(tc.fsys)
+			if !tc.isValid {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			if assert.Len(t, ms, 2) {
+				assert.Equal(t, uint(1), ms[0].Version)
+				assert.Equal(t, "create_t", ms[0].Name)
+				assert.Equal(t, "DROP TABLE t;", ms[0].Down)
+				assert.Equal(t, uint(2), ms[1].Version)
+			}
+		})
+	}
+}
+
+func TestLoad_Embedded(t *testing.T) {
+	ms, err := migrate.Load(migrations.FS)
+	assert.NoError(t, err)
+
+	// versions go one by one, so nothing was lost
+	for i, m := range ms {
+		assert.Equal(t, uint(i+1), m.Version)
+	}
+}
+
+func TestMigrator_AppliedVersion(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db, fstest.MapFS{
+		"000001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id integer)")},
+		"000001_create_users.down.sql": {Data: []byte("DROP TABLE users")},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	m.WithoutLock()
+
+	// nothing is created by the check
+	v, err := m.AppliedVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(0), v)
+	var tables int
+	assert.NoError(t, db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table'").Scan(&tables))
+	assert.Equal(t, 0, tables)
+
+	_, err = m.Up(ctx)
+	assert.NoError(t, err)
+	v, err = m.AppliedVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), v)
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// Types of client certificate names. Subjects mapped to users start with their type,
+// e.g. "dn:CN=billing,O=Acme" or "dns:billing.internal", so a name matches only mappings of its own type:
+// a SAN DNS name or URI which looks like a DN of another service must not authenticate as that service
+const (
+	CertificateDN    = "dn:"
+	CertificateDNS   = "dns:"
+	CertificateEmail = "email:"
+	CertificateURI   = "uri:"
+)
+
+var certificateTypes = []string{CertificateDN, CertificateDNS, CertificateEmail, CertificateURI}
+
+// ErrInvalidCertificateSubject is returned for subjects without type
+var ErrInvalidCertificateSubject = errors.New(`certificate subject must start with "dn:", "dns:", "email:" or "uri:"`)
+
+// ValidateCertificateSubject checks that subject starts with one of the types and has a name after it
+func ValidateCertificateSubject(subject string) error {
+	for _, t := range certificateTypes {
+		if strings.HasPrefix(subject, t) && len(subject) > len(t) {
+			return nil
+		}
+	}
+
+	return ErrInvalidCertificateSubject
+}
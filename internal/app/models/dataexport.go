@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Data export statuses
+const (
+	DataExportPending   = "pending"
+	DataExportCompleted = "completed"
+	DataExportFailed    = "failed"
+)
+
+// DataExport is a request of user to download everything we store about them.
+// Archive is assembled in background and saved to blob store with BlobKey
+type DataExport struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Status      string     `json:"status"`
+	BlobKey     string     `json:"-"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import "strings"
+
+// EmailOptions control how emails are normalized before they are stored or looked up
+type EmailOptions struct {
+	// ProviderRules enables provider specific rules, e.g. gmail ignores dots and "+tags" in the local part,
+	// so u.s.e.r+news@gmail.com and user@gmail.com become the same account
+	ProviderRules bool
+}
+
+// emailOptions are set once on server start, see SetEmailOptions
+var emailOptions EmailOptions
+
+// providers which deliver "local+tag@domain" to "local@domain"
+var subaddressingDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+	"outlook.com":    true,
+	"hotmail.com":    true,
+	"live.com":       true,
+	"icloud.com":     true,
+	"fastmail.com":   true,
+	"protonmail.com": true,
+	"proton.me":      true,
+}
+
+// SetEmailOptions changes normalization rules for the whole application.
+// Should be called before the server starts handling requests. Stored emails are normalized with
+// these rules, so they are fixed when the database is first used, see apiserver.checkSettings
+func SetEmailOptions(opts EmailOptions) {
+	emailOptions = opts
+}
+
+// NormalizeEmail returns canonical form of email which is used both for storing and searching:
+// spaces are trimmed, local part and domain are lower-cased, provider rules applied if enabled
+func NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !emailOptions.ProviderRules {
+		return email
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		// not an email at all, validation will complain about it
+		return email
+	}
+
+	local, domain := email[:at], email[at+1:]
+	if subaddressingDomains[domain] {
+		if i := strings.Index(local, "+"); i > 0 {
+			local = local[:i]
+		}
+	}
+
+	// gmail doesn't care about dots and googlemail.com is just an alias
+	if domain == "gmail.com" || domain == "googlemail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+
+	return local + "@" + domain
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+)
+
+// Invitation lets person with Email join organization with Role.
+// It's sent by email as a signed token and can be accepted only once before ExpiresAt
+type Invitation struct {
+	ID             int        `json:"id"`
+	OrganizationID int        `json:"organization_id"`
+	Email          string     `json:"email"`
+	Role           string     `json:"role"`
+	InvitedBy      int        `json:"invited_by"` // user ID
+	ExpiresAt      time.Time  `json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+}
+
+func (i *Invitation) Validate() error {
+	// owners are never invited, somebody should be promoted after joining
+	return validation.ValidateStruct(
+		i,
+		validation.Field(&i.Email, validation.Required, is.Email),
+		validation.Field(&i.Role, validation.Required, validation.In(RoleAdmin, RoleMember)),
+		validation.Field(&i.ExpiresAt, validation.Required),
+	)
+}
+
+// BeforeCreate normalizes email, so it matches the email of user who accepts invitation
+func (i *Invitation) BeforeCreate() error {
+	i.Email = NormalizeEmail(i.Email)
+	return nil
+}
+
+// IsActive tells whether invitation can still be accepted
+func (i *Invitation) IsActive(now time.Time) bool {
+	return i.AcceptedAt == nil && now.Before(i.ExpiresAt)
+}
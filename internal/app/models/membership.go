@@ -0,0 +1,30 @@
+package models
+
+import validation "github.com/go-ozzo/ozzo-validation"
+
+// Member roles. Owners can do everything, admins manage members, members only use the product
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// Membership links user to organization with some role
+type Membership struct {
+	OrganizationID int    `json:"organization_id"`
+	UserID         int    `json:"user_id"`
+	Role           string `json:"role"`
+	Email          string `json:"email,omitempty"` // email of the user, filled when members are listed
+}
+
+func (m *Membership) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.Role, validation.Required, validation.In(RoleOwner, RoleAdmin, RoleMember)),
+	)
+}
+
+// CanManageMembers tells whether member can change roles of other members and invite new ones
+func (m *Membership) CanManageMembers() bool {
+	return m.Role == RoleOwner || m.Role == RoleAdmin
+}
@@ -0,0 +1,16 @@
+package models
+
+import validation "github.com/go-ozzo/ozzo-validation"
+
+// Organization is a company which users belong to. Users are attached to organizations by Membership
+type Organization struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func (o *Organization) Validate() error {
+	return validation.ValidateStruct(
+		o,
+		validation.Field(&o.Name, validation.Required, validation.Length(1, 100)),
+	)
+}
@@ -0,0 +1,231 @@
+package models
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Hash formats which can come with imported users. Format is recognized by prefix of the hash.
+// bcrypt is the only one we generate ourselves, all the others are verified and then replaced, see NeedsRehash
+const (
+	hashPrefixDjangoPBKDF2 = "pbkdf2_sha256$"  // Django: pbkdf2_sha256$<iterations>$<salt>$<base64 hash>
+	hashPrefixPasslibPBKDF = "$pbkdf2-sha256$" // passlib: $pbkdf2-sha256$<iterations>$<ab64 salt>$<ab64 hash>
+	hashPrefixDjangoSHA1   = "sha1$"           // Django: sha1$<salt>$<hex sha1(salt + password)>
+	hashPrefixPHPass       = "$P$"             // phpass portable hashes (WordPress)
+	hashPrefixPHPassBB     = "$H$"             // the same as $P$, used by phpBB
+)
+
+// Limits of work factors read from imported hashes. Verification runs on every login attempt,
+// so one crafted hash with a huge work factor would tie up a CPU for every request with its email.
+// The limits are well above defaults of the tools which generate such hashes
+const (
+	maxPBKDF2Iterations = 2000000 // Django 5.x uses under a million, passlib 29000
+	maxPBKDF2KeyLength  = 64      // every 32 bytes of sha256 key cost all the iterations again
+	maxPHPassCountLog2  = 20      // WordPress uses 8
+)
+
+// bcrypt hashes may have any of these versions
+var bcryptPrefixes = []string{"$2a$", "$2b$", "$2y$"}
+
+// phpass alphabet for both iteration count and hash encoding
+const phpassItoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// isBcrypt tells whether hash was generated by the current algorithm
+func isBcrypt(hash string) bool {
+	for _, prefix := range bcryptPrefixes {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ErrInvalidPasswordHash is returned for hashes which are not in any of the supported formats
+var ErrInvalidPasswordHash = errors.New("unsupported or malformed password hash")
+
+// ValidatePasswordHash checks that hash is in one of the supported formats and its work factor
+// is within limits, i.e. that user with such hash is able to log in
+func ValidatePasswordHash(hash string) error {
+	if passwordVerifier(hash) == nil {
+		return ErrInvalidPasswordHash
+	}
+
+	return nil
+}
+
+// compareHashAndPassword picks verification algorithm by hash prefix.
+// Unknown and malformed hashes never match
+func compareHashAndPassword(hash, password string) bool {
+	verify := passwordVerifier(hash)
+	return verify != nil && verify(password)
+}
+
+// passwordVerifier parses hash and returns function which checks password against it.
+// Returns nil if hash can't be parsed
+func passwordVerifier(hash string) func(password string) bool {
+	switch {
+	case isBcrypt(hash):
+		return bcryptVerifier(hash)
+	case strings.HasPrefix(hash, hashPrefixDjangoPBKDF2):
+		return djangoPBKDF2Verifier(strings.TrimPrefix(hash, hashPrefixDjangoPBKDF2))
+	case strings.HasPrefix(hash, hashPrefixPasslibPBKDF):
+		return passlibPBKDF2Verifier(strings.TrimPrefix(hash, hashPrefixPasslibPBKDF))
+	case strings.HasPrefix(hash, hashPrefixDjangoSHA1):
+		return djangoSHA1Verifier(strings.TrimPrefix(hash, hashPrefixDjangoSHA1))
+	case strings.HasPrefix(hash, hashPrefixPHPass), strings.HasPrefix(hash, hashPrefixPHPassBB):
+		return phpassVerifier(hash)
+	}
+
+	return nil
+}
+
+func bcryptVerifier(hash string) func(string) bool {
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return nil
+	}
+
+	return func(password string) bool {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+}
+
+// djangoPBKDF2Verifier accepts "<iterations>$<salt>$<base64 hash>"
+func djangoPBKDF2Verifier(hash string) func(string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 3 {
+		return nil
+	}
+
+	iterations, err := strconv.Atoi(parts[0])
+	if err != nil || iterations <= 0 || iterations > maxPBKDF2Iterations {
+		return nil
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(expected) == 0 || len(expected) > maxPBKDF2KeyLength {
+		return nil
+	}
+
+	return pbkdf2Verifier([]byte(parts[1]), iterations, expected)
+}
+
+// passlibPBKDF2Verifier accepts "<iterations>$<ab64 salt>$<ab64 hash>",
+// where ab64 is base64 without padding and with "." instead of "+"
+func passlibPBKDF2Verifier(hash string) func(string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 3 {
+		return nil
+	}
+
+	iterations, err := strconv.Atoi(parts[0])
+	if err != nil || iterations <= 0 || iterations > maxPBKDF2Iterations {
+		return nil
+	}
+
+	salt, err := decodeAB64(parts[1])
+	if err != nil {
+		return nil
+	}
+
+	expected, err := decodeAB64(parts[2])
+	if err != nil || len(expected) == 0 || len(expected) > maxPBKDF2KeyLength {
+		return nil
+	}
+
+	return pbkdf2Verifier(salt, iterations, expected)
+}
+
+func pbkdf2Verifier(salt []byte, iterations int, expected []byte) func(string) bool {
+	return func(password string) bool {
+		actual := pbkdf2.Key([]byte(password), salt, iterations, len(expected), sha256.New)
+		return subtle.ConstantTimeCompare(actual, expected) == 1
+	}
+}
+
+func decodeAB64(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.ReplaceAll(s, ".", "+"))
+}
+
+// djangoSHA1Verifier accepts "<salt>$<hex digest>"
+func djangoSHA1Verifier(hash string) func(string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 2 {
+		return nil
+	}
+
+	expected, err := hex.DecodeString(parts[1])
+	if err != nil || len(expected) != sha1.Size {
+		return nil
+	}
+
+	return func(password string) bool {
+		actual := sha1.Sum([]byte(parts[0] + password))
+		return subtle.ConstantTimeCompare(actual[:], expected) == 1
+	}
+}
+
+// phpassVerifier implements phpass portable hashes: $P$ + iterations char + 8 chars of salt + 22 chars of hash
+func phpassVerifier(hash string) func(string) bool {
+	if len(hash) != 34 || strings.Trim(hash[3:], phpassItoa64) != "" {
+		return nil
+	}
+
+	countLog2 := strings.IndexByte(phpassItoa64, hash[3])
+	if countLog2 < 7 || countLog2 > maxPHPassCountLog2 {
+		return nil
+	}
+
+	return func(password string) bool {
+		salt := hash[4:12]
+		sum := md5.Sum([]byte(salt + password))
+		for count := 1 << countLog2; count > 0; count-- {
+			sum = md5.Sum(append(sum[:], password...))
+		}
+
+		actual := hash[:12] + phpassEncode64(sum[:])
+		return subtle.ConstantTimeCompare([]byte(actual), []byte(hash)) == 1
+	}
+}
+
+// phpassEncode64 is a port of encode64() from phpass, it's not compatible with standard base64
+func phpassEncode64(input []byte) string {
+	var sb strings.Builder
+	count := len(input)
+	for i := 0; i < count; {
+		value := int(input[i])
+		i++
+		sb.WriteByte(phpassItoa64[value&0x3f])
+		if i < count {
+			value |= int(input[i]) << 8
+		}
+		sb.WriteByte(phpassItoa64[(value>>6)&0x3f])
+		if i >= count {
+			break
+		}
+		i++
+
+		if i < count {
+			value |= int(input[i]) << 16
+		}
+		sb.WriteByte(phpassItoa64[(value>>12)&0x3f])
+		if i >= count {
+			break
+		}
+		i++
+
+		sb.WriteByte(phpassItoa64[(value>>18)&0x3f])
+	}
+
+	return sb.String()
+}
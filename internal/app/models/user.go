@@ -1,6 +1,9 @@
 package models
 
 import (
+	"fmt"
+	"time"
+
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
 	"golang.org/x/crypto/bcrypt"
@@ -13,6 +16,14 @@ type User struct {
 	Email             string `json:"email"`
 	Password          string `json:"password,omitempty"` // is password is empty, then don't return it
 	EncryptedPassword string `json:"-"`                  // do not render encr password
+	IsAdmin           bool   `json:"is_admin"`           // admins have access to /admin endpoints
+	AvatarURL         string `json:"avatar_url,omitempty"`
+	// ErasedAt is set when user asked to erase their data. Such users can't log in anymore,
+	// the row is kept only to not break references from other tables
+	ErasedAt *time.Time `json:"-"`
+	// Version is incremented by every update. Updates of stale copies are rejected,
+	// clients see it as ETag and send it back in If-Match
+	Version int `json:"-"`
 }
 
 func (u *User) Validate() error {
@@ -27,6 +38,9 @@ func (u *User) Validate() error {
 
 // Lesson3, timeframe 1:10
 func (u *User) BeforeCreate() error {
+	// store emails in canonical form, so User@Example.org and user@example.org are the same account
+	u.Email = NormalizeEmail(u.Email)
+
 	if len(u.Password) > 0 {
 		enc, err := encryptString(u.Password)
 		if err != nil {
@@ -38,15 +52,54 @@ func (u *User) BeforeCreate() error {
 	return nil
 }
 
+// BeforeUpdate prepares changed fields for saving the same way as BeforeCreate does:
+// email is normalized and new password (if any) is hashed
+func (u *User) BeforeUpdate() error {
+	return u.BeforeCreate()
+}
+
+// IsErased tells whether user's personal data was erased
+func (u *User) IsErased() bool {
+	return u.ErasedAt != nil
+}
+
+// Anonymize replaces personal data with placeholders. Email stays unique, so the row doesn't break unique index,
+// and password hash is removed, so nobody can log in
+func (u *User) Anonymize(now time.Time) {
+	u.Email = fmt.Sprintf("erased-%d@erased.invalid", u.ID)
+	u.Password = ""
+	u.EncryptedPassword = ""
+	u.AvatarURL = ""
+	u.IsAdmin = false
+	u.ErasedAt = &now
+}
+
 // Sanitize redefines private attributes that shouldn't be available outside
 func (u *User) Sanitize() {
 	u.Password = ""
 }
 
 // ComparePasswords check that password from session request corresponds to encrypted
-// will return true if comparison is OK
+// will return true if comparison is OK. Besides bcrypt, hashes of imported users are supported (see password.go)
 func (u *User) ComparePasswords(password string) bool {
-	return bcrypt.CompareHashAndPassword([]byte(u.EncryptedPassword), []byte(password)) == nil
+	return compareHashAndPassword(u.EncryptedPassword, password)
+}
+
+// NeedsRehash returns true if password is hashed by legacy algorithm.
+// Such hashes should be replaced by SetPassword right after successful ComparePasswords
+func (u *User) NeedsRehash() bool {
+	return !isBcrypt(u.EncryptedPassword)
+}
+
+// SetPassword hashes password with the current algorithm
+func (u *User) SetPassword(password string) error {
+	enc, err := encryptString(password)
+	if err != nil {
+		return err
+	}
+
+	u.EncryptedPassword = enc
+	return nil
 }
 
 func encryptString(s string) (string, error) {
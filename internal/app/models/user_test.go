@@ -3,7 +3,9 @@ package models_test
 import (
 	"github.com/gopherschool/http-rest-api/internal/app/models"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestUser_Validate(t *testing.T) {
@@ -90,3 +92,164 @@ func TestUser_BeforeCreate(t *testing.T) {
 	assert.NoError(t, u.BeforeCreate())
 	assert.NotEmpty(t, u.EncryptedPassword)
 }
+
+func TestUser_BeforeCreateNormalizesEmail(t *testing.T) {
+	u := models.TestUser(t)
+	u.Email = " User@Example.ORG "
+	assert.NoError(t, u.BeforeCreate())
+	assert.Equal(t, "user@example.org", u.Email)
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	testCases := []struct {
+		name          string
+		email         string
+		providerRules bool
+		expected      string
+	}{
+		{
+			name:     "lower case",
+			email:    "User@Example.org",
+			expected: "user@example.org",
+		},
+		{
+			name:     "gmail without provider rules",
+			email:    "U.Ser+news@Gmail.com",
+			expected: "u.ser+news@gmail.com",
+		},
+		{
+			name:          "gmail with provider rules",
+			email:         "U.Ser+news@GoogleMail.com",
+			providerRules: true,
+			expected:      "user@gmail.com",
+		},
+		{
+			name:          "tags are kept for unknown providers",
+			email:         "first.last+tag@example.org",
+			providerRules: true,
+			expected:      "first.last+tag@example.org",
+		},
+		{
+			name:          "tags are removed for known providers",
+			email:         "first.last+tag@outlook.com",
+			providerRules: true,
+			expected:      "first.last@outlook.com",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			models.SetEmailOptions(models.EmailOptions{ProviderRules: tc.providerRules})
+			defer models.SetEmailOptions(models.EmailOptions{})
+
+			assert.Equal(t, tc.expected, models.NormalizeEmail(tc.email))
+		})
+	}
+}
+
+func TestUser_ComparePasswords(t *testing.T) {
+	bcryptUser := models.TestUser(t)
+	assert.NoError(t, bcryptUser.BeforeCreate())
+
+	testCases := []struct {
+		name        string
+		hash        string
+		password    string
+		needsRehash bool
+	}{
+		{
+			name:     "bcrypt",
+			hash:     bcryptUser.EncryptedPassword,
+			password: "password",
+		},
+		{
+			name:        "django pbkdf2",
+			hash:        "pbkdf2_sha256$1000$seasalt$YIWkt6M1JFXrHg5s0jZjBSc7C2Cz6QvchSJ0h8Y+i7c=",
+			password:    "password",
+			needsRehash: true,
+		},
+		{
+			name:        "passlib pbkdf2",
+			hash:        "$pbkdf2-sha256$1000$AAECAwQFBgcICQoLDA0ODw$JeuGrMduQwGPGLmo.Qwv7UYtHHmeg9SK49fGkEamC2c",
+			password:    "password",
+			needsRehash: true,
+		},
+		{
+			name:        "salted sha1",
+			hash:        "sha1$a1b2$33f40cdfea64983c20fc624ca2df455a11e8338a",
+			password:    "password",
+			needsRehash: true,
+		},
+		{
+			name:        "phpass",
+			hash:        "$P$9IQRaTwmfeRo7ud9Fh4E2PdI0S3r.L0",
+			password:    "test12345",
+			needsRehash: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &models.User{EncryptedPassword: tc.hash}
+			assert.True(t, u.ComparePasswords(tc.password))
+			assert.False(t, u.ComparePasswords(tc.password+"!"))
+			assert.Equal(t, tc.needsRehash, u.NeedsRehash())
+
+			assert.NoError(t, u.SetPassword(tc.password))
+			assert.False(t, u.NeedsRehash())
+			assert.True(t, u.ComparePasswords(tc.password))
+		})
+	}
+
+	// unknown formats never match
+	u := &models.User{EncryptedPassword: "md5$password"}
+	assert.False(t, u.ComparePasswords("password"))
+}
+
+func TestValidatePasswordHash(t *testing.T) {
+	u := models.TestUser(t)
+	assert.NoError(t, u.BeforeCreate())
+
+	valid := []string{
+		u.EncryptedPassword,
+		"pbkdf2_sha256$1000$seasalt$YIWkt6M1JFXrHg5s0jZjBSc7C2Cz6QvchSJ0h8Y+i7c=",
+		"$pbkdf2-sha256$1000$AAECAwQFBgcICQoLDA0ODw$JeuGrMduQwGPGLmo.Qwv7UYtHHmeg9SK49fGkEamC2c",
+		"sha1$a1b2$33f40cdfea64983c20fc624ca2df455a11e8338a",
+		"$P$9IQRaTwmfeRo7ud9Fh4E2PdI0S3r.L0",
+	}
+	for _, hash := range valid {
+		assert.NoError(t, models.ValidatePasswordHash(hash), hash)
+	}
+
+	invalid := []string{
+		"",
+		"md5$password",
+		"$2a$04$abcdefghijklmnopqrstuu", // too short for bcrypt
+		"pbkdf2_sha256$1000$seasalt",
+		"pbkdf2_sha256$2000000000$seasalt$YIWkt6M1JFXrHg5s0jZjBSc7C2Cz6QvchSJ0h8Y+i7c=",
+		"sha1$a1b2$33f40cdf",
+		"$P$SIQRaTwmfeRo7ud9Fh4E2PdI0S3r.L0",
+		"$P$9IQRaTwmfeRo7ud9Fh4E2PdI0S3r!L0",
+	}
+	for _, hash := range invalid {
+		assert.ErrorIs(t, models.ValidatePasswordHash(hash), models.ErrInvalidPasswordHash, hash)
+	}
+}
+
+func TestUser_ComparePasswords_WorkFactorLimits(t *testing.T) {
+	// hashes of "password" and "test12345" with work factors nobody uses: too many iterations
+	// or too long key, verifying any of them would take minutes
+	hashes := map[string]string{
+		"pbkdf2_sha256$2000000000$seasalt$YIWkt6M1JFXrHg5s0jZjBSc7C2Cz6QvchSJ0h8Y+i7c=":                "password",
+		"$pbkdf2-sha256$2000000000$AAECAwQFBgcICQoLDA0ODw$JeuGrMduQwGPGLmo.Qwv7UYtHHmeg9SK49fGkEamC2c": "password",
+		"pbkdf2_sha256$1000$seasalt$" + strings.Repeat("A", 1<<20):                                     "password",
+		"$P$SIQRaTwmfeRo7ud9Fh4E2PdI0S3r.L0":                                                           "test12345",
+	}
+
+	start := time.Now()
+	for hash, password := range hashes {
+		u := &models.User{EncryptedPassword: hash}
+		assert.False(t, u.ComparePasswords(password))
+	}
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
@@ -0,0 +1,129 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gopherschool/http-rest-api/internal/app/avatar"
+	"github.com/gopherschool/http-rest-api/internal/app/blobstore"
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// ErrSoleOwner is returned when user is the only owner of organization with other members.
+// Ownership must be transferred first, otherwise nobody could manage the organization
+var ErrSoleOwner = errors.New("user is the only owner of organization with other members, transfer ownership first")
+
+// Erase removes personal data of user. Rows which only link user to something (memberships, invitations
+// to user's email, exports) are deleted, the users row itself is anonymized, so references from other tables
+// (e.g. invitations sent by user) stay valid. Organizations where user is the only member are deleted,
+// nobody could use them anymore. Avatars are removed from blobs and archives of exports from exports
+// after the transaction is committed. Export jobs of user must be finished before, otherwise they can save
+// an archive after it was deleted
+func Erase(ctx context.Context, s store.Store, blobs, exports blobstore.BlobStore, u *models.User) error {
+	var exportKeys []string
+	// serializable, so co-owners erased at the same time can't leave organization without owners
+	opts := &store.TxOptions{Isolation: store.IsolationSerializable, MaxRetries: store.DefaultTxMaxRetries}
+	if err := s.WithTx(ctx, opts, func(tx store.Store) error {
+		abandoned, err := checkNotSoleOwner(ctx, tx, u)
+		if err != nil {
+			return err
+		}
+
+		dataExports, err := tx.DataExport().ListByUser(ctx, u.ID)
+		if err != nil {
+			return err
+		}
+
+		// failed or cancelled jobs may leave an archive without saving its key, so keys are built for every export
+		exportKeys = []string{}
+		for _, e := range dataExports {
+			exportKeys = append(exportKeys, ExportKey(e))
+		}
+
+		if err := tx.Membership().DeleteByUser(ctx, u.ID); err != nil {
+			return err
+		}
+
+		for _, id := range abandoned {
+			if err := tx.Organization().Delete(ctx, id); err != nil {
+				return err
+			}
+		}
+
+		// must go before Anonymize, email is replaced there
+		if err := tx.Invitation().DeleteByEmail(ctx, u.Email); err != nil {
+			return err
+		}
+
+		if err := tx.DataExport().DeleteByUser(ctx, u.ID); err != nil {
+			return err
+		}
+
+		return tx.User().Anonymize(ctx, u)
+	}); err != nil {
+		return err
+	}
+
+	avatarKeys := []string{}
+	for _, size := range avatar.Sizes {
+		avatarKeys = append(avatarKeys, avatar.Key(u.ID, size))
+	}
+
+	// try to delete everything even if some blob fails, the first error is returned
+	var firstErr error
+	deleteBlobs := func(bs blobstore.BlobStore, keys []string) {
+		if bs == nil {
+			return
+		}
+
+		for _, key := range keys {
+			if err := bs.Delete(key); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	deleteBlobs(blobs, avatarKeys)
+	deleteBlobs(exports, exportKeys)
+	return firstErr
+}
+
+// checkNotSoleOwner returns ErrSoleOwner if leaving any organization would leave it without owners.
+// Otherwise it returns IDs of organizations where user is the only member
+func checkNotSoleOwner(ctx context.Context, s store.Store, u *models.User) ([]int, error) {
+	memberships, err := s.Membership().ListByUser(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	abandoned := []int{}
+	for _, m := range memberships {
+		members, err := s.Membership().ListByOrganization(ctx, m.OrganizationID)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(members) == 1 {
+			abandoned = append(abandoned, m.OrganizationID)
+			continue
+		}
+
+		if m.Role != models.RoleOwner {
+			continue
+		}
+
+		owners := 0
+		for _, other := range members {
+			if other.Role == models.RoleOwner {
+				owners++
+			}
+		}
+
+		if owners == 1 {
+			return nil, ErrSoleOwner
+		}
+	}
+
+	return abandoned, nil
+}
@@ -0,0 +1,161 @@
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gopherschool/http-rest-api/internal/app/avatar"
+	"github.com/gopherschool/http-rest-api/internal/app/blobstore"
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// ExportContentType of generated archives
+const ExportContentType = "application/zip"
+
+// readme is put in every archive, so people know what they got
+const readme = `This archive contains all personal data stored about you:
+
+profile.json      - your account
+memberships.json  - organizations you belong to and your roles
+invitations.json  - invitations sent to your email
+data_exports.json - your previous data export requests
+avatar/           - your avatar thumbnails, if you uploaded one
+
+Sessions are kept only in a signed cookie in your browser, the server doesn't store them.
+No audit log is kept.
+`
+
+// profile is what is exported about user, password hash is not personal data and is not included
+type profile struct {
+	ID        int    `json:"id"`
+	Email     string `json:"email"`
+	IsAdmin   bool   `json:"is_admin"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+}
+
+// membership is exported with organization name, IDs alone don't tell anything to user
+type membership struct {
+	OrganizationID   int    `json:"organization_id"`
+	OrganizationName string `json:"organization_name"`
+	Role             string `json:"role"`
+}
+
+// ExportKey returns blob key of export archive. Archives must be kept in a blob store which is never served,
+// they are downloaded only through the API by their owners
+func ExportKey(e *models.DataExport) string {
+	return fmt.Sprintf("%d/%d.zip", e.UserID, e.ID)
+}
+
+// BuildExport writes ZIP archive with everything stored about user to w
+func BuildExport(ctx context.Context, w io.Writer, s store.Store, blobs blobstore.BlobStore, u *models.User) error {
+	zw := zip.NewWriter(w)
+
+	if err := writeFile(zw, "README.txt", []byte(readme)); err != nil {
+		return err
+	}
+
+	if err := writeJSON(zw, "profile.json", &profile{
+		ID:        u.ID,
+		Email:     u.Email,
+		IsAdmin:   u.IsAdmin,
+		AvatarURL: u.AvatarURL,
+	}); err != nil {
+		return err
+	}
+
+	members, err := s.Membership().ListByUser(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+
+	memberships := make([]*membership, 0, len(members))
+	for _, m := range members {
+		o, err := s.Organization().FindByID(ctx, m.OrganizationID)
+		if err != nil {
+			return err
+		}
+
+		memberships = append(memberships, &membership{
+			OrganizationID:   o.ID,
+			OrganizationName: o.Name,
+			Role:             m.Role,
+		})
+	}
+
+	if err := writeJSON(zw, "memberships.json", memberships); err != nil {
+		return err
+	}
+
+	invitations, err := s.Invitation().ListByEmail(ctx, u.Email)
+	if err != nil {
+		return err
+	}
+
+	if err := writeJSON(zw, "invitations.json", invitations); err != nil {
+		return err
+	}
+
+	exports, err := s.DataExport().ListByUser(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := writeJSON(zw, "data_exports.json", exports); err != nil {
+		return err
+	}
+
+	if u.AvatarURL != "" && blobs != nil {
+		for _, size := range avatar.Sizes {
+			if err := copyBlob(zw, blobs, avatar.Key(u.ID, size), fmt.Sprintf("avatar/%d.png", size)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(zw, name, b)
+}
+
+func writeFile(zw *zip.Writer, name string, content []byte) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(content)
+	return err
+}
+
+// copyBlob puts blob into archive, missing blobs are skipped
+func copyBlob(zw *zip.Writer, blobs blobstore.BlobStore, key, name string) error {
+	r, err := blobs.Open(key)
+	if err == blobstore.ErrNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	return err
+}
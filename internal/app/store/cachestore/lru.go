@@ -0,0 +1,141 @@
+package cachestore
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+)
+
+// userCache is LRU of users with TTL, users can be found both by ID and by normalized email.
+// Copies are stored and returned, so callers can't change cached users
+type userCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	ll      *list.List // front is the most recently used
+	byID    map[int]*list.Element
+	byEmail map[string]*list.Element
+	hits    uint64
+	misses  uint64
+	// gen is incremented by every invalidate. Loads take it before going to the wrapped store, and set
+	// drops users loaded before an invalidation: they may be older than the write which invalidated them
+	gen uint64
+}
+
+type entry struct {
+	user    models.User
+	email   string // normalized, key of byEmail
+	expires time.Time
+}
+
+func newUserCache(size int, ttl time.Duration) *userCache {
+	return &userCache{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		ll:      list.New(),
+		byID:    make(map[int]*list.Element),
+		byEmail: make(map[string]*list.Element),
+	}
+}
+
+func (c *userCache) getByID(id int) (*models.User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.get(c.byID[id])
+}
+
+func (c *userCache) getByEmail(email string) (*models.User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.get(c.byEmail[models.NormalizeEmail(email)])
+}
+
+// get must be called with mu held
+func (c *userCache) get(el *list.Element) (*models.User, bool) {
+	if el == nil {
+		c.misses++
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if c.now().After(e.expires) {
+		c.remove(el)
+		c.misses++
+		return nil, false
+	}
+
+	c.hits++
+	c.ll.MoveToFront(el)
+	u := e.user
+	return &u, true
+}
+
+// generation must be taken before user is loaded from the wrapped store and passed to set
+func (c *userCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.gen
+}
+
+// set caches u unless something was invalidated since gen was taken
+func (c *userCache) set(u *models.User, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+
+	// replaced as a whole, email could change
+	if el, ok := c.byID[u.ID]; ok {
+		c.remove(el)
+	}
+
+	e := &entry{user: *u, email: models.NormalizeEmail(u.Email), expires: c.now().Add(c.ttl)}
+	if el, ok := c.byEmail[e.email]; ok {
+		c.remove(el)
+	}
+
+	el := c.ll.PushFront(e)
+	c.byID[u.ID] = el
+	c.byEmail[e.email] = el
+
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+// invalidate forgets user with id, both by ID and by email, and makes set drop users
+// whose loading has already started
+func (c *userCache) invalidate(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+
+	if el, ok := c.byID[id]; ok {
+		c.remove(el)
+	}
+}
+
+// remove must be called with mu held
+func (c *userCache) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	c.ll.Remove(el)
+	delete(c.byID, e.user.ID)
+	delete(c.byEmail, e.email)
+}
+
+func (c *userCache) stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{Hits: c.hits, Misses: c.misses, Size: c.ll.Len()}
+}
@@ -0,0 +1,56 @@
+package cachestore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+)
+
+func TestUserCache(t *testing.T) {
+	now := time.Now()
+	c := newUserCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.set(&models.User{ID: 1, Email: "one@example.org"}, c.generation())
+	c.set(&models.User{ID: 2, Email: "two@example.org"}, c.generation())
+
+	// 1 becomes the most recently used, so 2 is evicted
+	_, ok := c.getByID(1)
+	assert.True(t, ok)
+	c.set(&models.User{ID: 3, Email: "three@example.org"}, c.generation())
+	_, ok = c.getByEmail("Two@Example.org")
+	assert.False(t, ok)
+
+	u, ok := c.getByEmail("ONE@example.org")
+	assert.True(t, ok)
+	assert.Equal(t, 1, u.ID)
+
+	// email has changed, the old one must not be found anymore
+	c.set(&models.User{ID: 1, Email: "first@example.org"}, c.generation())
+	_, ok = c.getByEmail("one@example.org")
+	assert.False(t, ok)
+
+	now = now.Add(2 * time.Minute)
+	_, ok = c.getByID(3)
+	assert.False(t, ok)
+
+	assert.Equal(t, Stats{Hits: 2, Misses: 3, Size: 1}, c.stats())
+}
+
+func TestUserCache_InvalidateDuringLoad(t *testing.T) {
+	c := newUserCache(2, time.Minute)
+
+	// user is loaded, then changed and invalidated by another request, then the old copy comes to set
+	gen := c.generation()
+	c.invalidate(1)
+	c.set(&models.User{ID: 1, Email: "old@example.org"}, gen)
+	_, ok := c.getByID(1)
+	assert.False(t, ok)
+
+	c.set(&models.User{ID: 1, Email: "new@example.org"}, c.generation())
+	_, ok = c.getByID(1)
+	assert.True(t, ok)
+}
@@ -0,0 +1,84 @@
+// Package cachestore wraps any store.Store and caches user lookups, which happen on every authenticated request.
+// Writes made through the wrapper invalidate cached users. Writes made by other instances are seen
+// only after TTL, so TTL is the longest time a stale user (e.g. an erased one) can be served
+package cachestore
+
+import (
+	"context"
+	"time"
+
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// Options of the cache
+type Options struct {
+	Size int // max number of cached users
+	TTL  time.Duration
+}
+
+// Stats are counters of the cache since it was created
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Size   int    `json:"size"` // number of cached users
+}
+
+// Store caches FindByID and FindByEmail of users, everything else goes to the wrapped store as is
+type Store struct {
+	store.Store
+	cache          *userCache
+	userRepository *UserRepository
+	// touched is not nil inside of WithTx and collects IDs of changed users,
+	// they are invalidated once more when the transaction is finished
+	touched *[]int
+}
+
+// New wraps s
+func New(s store.Store, opts Options) *Store {
+	return newStore(s, newUserCache(opts.Size, opts.TTL), nil)
+}
+
+// newStore returns store with the caching repository created at once, so concurrent calls of User() don't race
+func newStore(s store.Store, cache *userCache, touched *[]int) *Store {
+	cs := &Store{Store: s, cache: cache, touched: touched}
+	cs.userRepository = &UserRepository{store: cs, users: s.User()}
+	return cs
+}
+
+// User returns caching repository
+func (s *Store) User() store.UserRepository {
+	return s.userRepository
+}
+
+// WithTx passes to fn a caching store bound to the transaction. Inside of it reads don't use the cache:
+// uncommitted data must not be cached, and the cache could return data older than the transaction has seen
+func (s *Store) WithTx(ctx context.Context, opts *store.TxOptions, fn func(store.Store) error) error {
+	if s.touched != nil {
+		return s.Store.WithTx(ctx, opts, fn)
+	}
+
+	var touched []int
+	err := s.Store.WithTx(ctx, opts, func(tx store.Store) error {
+		return fn(newStore(tx, s.cache, &touched))
+	})
+
+	// others could load old versions of these users while the transaction was running
+	for _, id := range touched {
+		s.cache.invalidate(id)
+	}
+
+	return err
+}
+
+// Stats returns hit/miss counters
+func (s *Store) Stats() Stats {
+	return s.cache.stats()
+}
+
+// invalidate forgets user after a write
+func (s *Store) invalidate(id int) {
+	s.cache.invalidate(id)
+	if s.touched != nil {
+		*s.touched = append(*s.touched, id)
+	}
+}
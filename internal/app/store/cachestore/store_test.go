@@ -0,0 +1,76 @@
+package cachestore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+	"github.com/gopherschool/http-rest-api/internal/app/store/cachestore"
+	"github.com/gopherschool/http-rest-api/internal/app/store/storetest"
+	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
+)
+
+func TestStore_User(t *testing.T) {
+	ctx := context.Background()
+	s := cachestore.New(teststore.NewStore(), cachestore.Options{Size: 10, TTL: time.Minute})
+	u := models.TestUser(t)
+	assert.NoError(t, s.User().Create(ctx, u))
+
+	found, err := s.User().FindByID(ctx, u.ID)
+	assert.NoError(t, err)
+	_, err = s.User().FindByEmail(ctx, u.Email)
+	assert.NoError(t, err)
+	assert.Equal(t, cachestore.Stats{Hits: 1, Misses: 1, Size: 1}, s.Stats())
+
+	// cached user is a copy
+	found.Email = "changed@example.org"
+	found, err = s.User().FindByID(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "user@example.org", found.Email)
+
+	found.AvatarURL = "/uploads/avatars/1/256.png"
+	assert.NoError(t, s.User().UpdateAvatarURL(ctx, found))
+	found, err = s.User().FindByID(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "/uploads/avatars/1/256.png", found.AvatarURL)
+
+	_, err = s.User().FindByID(ctx, u.ID+1)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+}
+
+func TestStore_WithTx(t *testing.T) {
+	ctx := context.Background()
+	s := cachestore.New(teststore.NewStore(), cachestore.Options{Size: 10, TTL: time.Minute})
+	u := models.TestUser(t)
+	assert.NoError(t, s.User().Create(ctx, u))
+	_, err := s.User().FindByID(ctx, u.ID)
+	assert.NoError(t, err)
+
+	errFailed := errors.New("failed")
+	err = s.WithTx(ctx, nil, func(tx store.Store) error {
+		found, err := tx.User().FindByID(ctx, u.ID)
+		assert.NoError(t, err)
+
+		found.Email = "new@example.org"
+		assert.NoError(t, tx.User().Update(ctx, found))
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+
+	// user changed in transaction is invalidated and loaded again, rolled back change is not cached anywhere
+	found, err := s.User().FindByID(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "user@example.org", found.Email)
+	assert.Equal(t, uint64(0), s.Stats().Hits)
+}
+
+func TestStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return cachestore.New(teststore.NewStore(), cachestore.Options{Size: 10, TTL: time.Minute})
+	})
+}
@@ -0,0 +1,100 @@
+package cachestore
+
+import (
+	"context"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// UserRepository caches lookups of the wrapped repository
+type UserRepository struct {
+	store *Store
+	users store.UserRepository
+}
+
+func (r *UserRepository) Create(ctx context.Context, u *models.User) error {
+	return r.users.Create(ctx, u)
+}
+
+// FindByEmail is used by login
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	if r.store.touched != nil {
+		return r.users.FindByEmail(ctx, email)
+	}
+
+	if u, ok := r.store.cache.getByEmail(email); ok {
+		return u, nil
+	}
+
+	gen := r.store.cache.generation()
+	u, err := r.users.FindByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	r.store.cache.set(u, gen)
+	return u, nil
+}
+
+// FindByID is used by authenticateUser on every private request
+func (r *UserRepository) FindByID(ctx context.Context, id int) (*models.User, error) {
+	if r.store.touched != nil {
+		return r.users.FindByID(ctx, id)
+	}
+
+	if u, ok := r.store.cache.getByID(id); ok {
+		return u, nil
+	}
+
+	gen := r.store.cache.generation()
+	u, err := r.users.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	r.store.cache.set(u, gen)
+	return u, nil
+}
+
+// Update and other writes invalidate user even if they fail: ErrConflict means the cached copy is stale anyway
+func (r *UserRepository) Update(ctx context.Context, u *models.User) error {
+	defer r.store.invalidate(u.ID)
+	return r.users.Update(ctx, u)
+}
+
+func (r *UserRepository) UpdateEncryptedPassword(ctx context.Context, u *models.User) error {
+	defer r.store.invalidate(u.ID)
+	return r.users.UpdateEncryptedPassword(ctx, u)
+}
+
+func (r *UserRepository) UpdateAvatarURL(ctx context.Context, u *models.User) error {
+	defer r.store.invalidate(u.ID)
+	return r.users.UpdateAvatarURL(ctx, u)
+}
+
+func (r *UserRepository) Anonymize(ctx context.Context, u *models.User) error {
+	defer r.store.invalidate(u.ID)
+	return r.users.Anonymize(ctx, u)
+}
+
+// List is not cached, it's used by export only
+func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*models.User, error) {
+	return r.users.List(ctx, limit, offset)
+}
+
+// Search is not cached, results depend on the query
+func (r *UserRepository) Search(ctx context.Context, query string, limit, offset int) ([]*models.User, error) {
+	return r.users.Search(ctx, query, limit, offset)
+}
+
+// AddCertificateSubject is passed as is, FindByCertificateSubject is not cached, so there is nothing to invalidate
+func (r *UserRepository) AddCertificateSubject(ctx context.Context, userID int, subject string) error {
+	return r.users.AddCertificateSubject(ctx, userID, subject)
+}
+
+// FindByCertificateSubject is not cached: there are few services with certificates,
+// and removed mappings must stop working at once
+func (r *UserRepository) FindByCertificateSubject(ctx context.Context, subject string) (*models.User, error) {
+	return r.users.FindByCertificateSubject(ctx, subject)
+}
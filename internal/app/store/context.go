@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type ctxKey int
+
+const ctxKeyWrites ctxKey = iota
+
+// writes is shared by all contexts derived from the tracked one
+type writes struct {
+	done int32
+}
+
+// WithWriteTracking returns context which remembers writes made with it. Stores with read replicas
+// send reads to the primary after a write, so a request always sees what it has just written
+func WithWriteTracking(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(ctxKeyWrites).(*writes); ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, ctxKeyWrites, &writes{})
+}
+
+// WithPrimary returns context whose reads always go to the primary, e.g. for background jobs
+// which read data written right before they were started
+func WithPrimary(ctx context.Context) context.Context {
+	ctx = WithWriteTracking(ctx)
+	MarkWritten(ctx)
+	return ctx
+}
+
+// MarkWritten is called by stores on every write. Does nothing if ctx isn't tracked
+func MarkWritten(ctx context.Context) {
+	if w, ok := ctx.Value(ctxKeyWrites).(*writes); ok {
+		atomic.StoreInt32(&w.done, 1)
+	}
+}
+
+// Written reports whether anything was written with ctx
+func Written(ctx context.Context) bool {
+	w, ok := ctx.Value(ctxKeyWrites).(*writes)
+	return ok && atomic.LoadInt32(&w.done) == 1
+}
@@ -0,0 +1,28 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+func TestWriteTracking(t *testing.T) {
+	ctx := context.Background()
+	store.MarkWritten(ctx) // not tracked, nothing happens
+	assert.False(t, store.Written(ctx))
+
+	ctx = store.WithWriteTracking(ctx)
+	child, cancel := context.WithCancel(ctx)
+	defer cancel()
+	assert.False(t, store.Written(ctx))
+
+	// writes with derived contexts are seen by the whole request
+	store.MarkWritten(child)
+	assert.True(t, store.Written(ctx))
+	assert.True(t, store.Written(store.WithWriteTracking(ctx)))
+
+	assert.True(t, store.Written(store.WithPrimary(context.Background())))
+}
@@ -4,4 +4,8 @@ import "errors"
 
 var (
 	ErrRecordNotFound = errors.New("record not found")
+	// ErrDuplicate is returned when a record violates a unique constraint (e.g. email is already taken)
+	ErrDuplicate = errors.New("record already exists")
+	// ErrConflict is returned when a write conflicts with the current state of related records
+	ErrConflict = errors.New("record conflicts with existing data")
 )
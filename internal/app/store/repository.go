@@ -1,10 +1,85 @@
 package store
 
-import "github.com/gopherschool/http-rest-api/internal/app/models"
+import (
+	"context"
 
-// UserRepository is an interface for user repositories
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+)
+
+// UserRepository is an interface for user repositories.
+// All repositories take context of the caller, so queries are cancelled together with the request
 type UserRepository interface {
-	Create(*models.User) error
-	FindByEmail(string) (*models.User, error)
-	FindByID(int) (*models.User, error)
+	Create(context.Context, *models.User) error
+	FindByEmail(context.Context, string) (*models.User, error)
+	FindByID(context.Context, int) (*models.User, error)
+	// Update saves email, password hash and admin flag. Like all other update methods it saves user only
+	// if it still has u.Version, increments u.Version on success and returns ErrConflict otherwise
+	Update(context.Context, *models.User) error
+	// UpdateEncryptedPassword saves u.EncryptedPassword for user with u.ID
+	UpdateEncryptedPassword(context.Context, *models.User) error
+	// UpdateAvatarURL saves u.AvatarURL for user with u.ID
+	UpdateAvatarURL(context.Context, *models.User) error
+	// List returns at most limit users ordered by ID, skipping first offset ones
+	List(ctx context.Context, limit, offset int) ([]*models.User, error)
+	// Search returns users matching query by part of email, best matches go first
+	Search(ctx context.Context, query string, limit, offset int) ([]*models.User, error)
+	// Anonymize replaces personal data of user with placeholders and sets u.ErasedAt
+	Anonymize(context.Context, *models.User) error
+	// AddCertificateSubject lets client certificate with subject (DN or SAN) authenticate as user with userID.
+	// subject starts with its type, see models.CertificateDN, models.ErrInvalidCertificateSubject is returned
+	// without it. It returns ErrDuplicate if subject is already taken and ErrConflict if user doesn't exist
+	AddCertificateSubject(ctx context.Context, userID int, subject string) error
+	// FindByCertificateSubject returns user added for typed subject, ErrRecordNotFound if there is none
+	FindByCertificateSubject(ctx context.Context, subject string) (*models.User, error)
+}
+
+// OrganizationRepository is an interface for organization repositories
+type OrganizationRepository interface {
+	Create(context.Context, *models.Organization) error
+	FindByID(context.Context, int) (*models.Organization, error)
+	// Delete removes organization together with its memberships and invitations
+	Delete(ctx context.Context, id int) error
+}
+
+// MembershipRepository is an interface for repositories which attach users to organizations
+type MembershipRepository interface {
+	// Create returns ErrDuplicate if user is already a member and ErrConflict if user or organization doesn't exist
+	Create(context.Context, *models.Membership) error
+	Find(ctx context.Context, organizationID, userID int) (*models.Membership, error)
+	// ListByOrganization returns members ordered by user ID, with emails filled
+	ListByOrganization(ctx context.Context, organizationID int) ([]*models.Membership, error)
+	// UpdateRole saves m.Role of existing membership
+	UpdateRole(context.Context, *models.Membership) error
+	// ListByUser returns all memberships of user ordered by organization ID
+	ListByUser(ctx context.Context, userID int) ([]*models.Membership, error)
+	DeleteByUser(ctx context.Context, userID int) error
+}
+
+// InvitationRepository is an interface for repositories of invitations to organizations
+type InvitationRepository interface {
+	Create(context.Context, *models.Invitation) error
+	FindByID(context.Context, int) (*models.Invitation, error)
+	// MarkAccepted sets i.AcceptedAt. Returns ErrConflict if invitation was already accepted
+	MarkAccepted(context.Context, *models.Invitation) error
+	// ListByEmail returns invitations sent to email ordered by ID
+	ListByEmail(ctx context.Context, email string) ([]*models.Invitation, error)
+	DeleteByEmail(ctx context.Context, email string) error
+}
+
+// DataExportRepository is an interface for repositories of personal data exports
+type DataExportRepository interface {
+	Create(context.Context, *models.DataExport) error
+	FindByID(context.Context, int) (*models.DataExport, error)
+	// Update saves status, blob key, error and completion time of export
+	Update(context.Context, *models.DataExport) error
+	ListByUser(ctx context.Context, userID int) ([]*models.DataExport, error)
+	DeleteByUser(ctx context.Context, userID int) error
+}
+
+// SettingRepository keeps settings which are chosen when the database is first used and must not change later
+type SettingRepository interface {
+	// Create returns ErrDuplicate if setting with name already exists
+	Create(ctx context.Context, name, value string) error
+	// Find returns ErrRecordNotFound if setting with name doesn't exist
+	Find(ctx context.Context, name string) (string, error)
 }
@@ -0,0 +1,46 @@
+package sqlitestore
+
+import (
+	"context"
+
+	"github.com/gopherschool/http-rest-api/internal/app/store/sqlrepo"
+)
+
+// dialect is what sqlrepo repositories need to know about SQLite. CURRENT_TIMESTAMP has only seconds
+// and no time zone, so creation times are set by repositories
+var dialect = &sqlrepo.Dialect{
+	TranslateError: translateError,
+	SearchUsers:    searchUsers,
+	SetCreatedAt:   true,
+}
+
+// conn gives sqlrepo repositories connections of the store. There are no replicas,
+// so reads and writes go to the same place
+type conn struct {
+	s *Store
+}
+
+func (c conn) Reader(ctx context.Context) sqlrepo.Querier {
+	return c.s.querier()
+}
+
+func (c conn) Writer(ctx context.Context) sqlrepo.Querier {
+	return c.s.querier()
+}
+
+func (c conn) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return c.s.withTimeout(ctx)
+}
+
+// searchUsers finds users whose email contains query. SQLite has no trigram indexes, so the ranking
+// is the same as in teststore: emails starting with query go first, then shorter (closer) ones
+func searchUsers(query string, limit, offset int) (string, []interface{}) {
+	return `SELECT ` + sqlrepo.UserColumns + ` FROM users
+		WHERE lower(email) LIKE '%' || $1 || '%' ESCAPE '\'
+		ORDER BY
+			lower(email) LIKE $1 || '%' ESCAPE '\' DESC,
+			length(email),
+			id
+		LIMIT $2 OFFSET $3`,
+		[]interface{}{sqlrepo.EscapeLike(query), limit, offset}
+}
@@ -0,0 +1,48 @@
+package sqlitestore
+
+import (
+	"errors"
+
+	sqlite "github.com/glebarez/go-sqlite"
+
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// SQLite result codes we care about. Full list: https://www.sqlite.org/rescode.html
+const (
+	sqliteBusy                   = 5
+	sqliteLocked                 = 6
+	sqliteConstraintForeignKey   = 787
+	sqliteConstraintPrimaryKey   = 1555
+	sqliteConstraintUnique       = 2067
+	sqlitePrimaryResultCodesMask = 0xff
+)
+
+// translateError maps driver specific errors to store errors,
+// so the handlers never see (and never leak) raw sqlite messages
+func translateError(err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+
+	switch sqliteErr.Code() {
+	case sqliteConstraintUnique, sqliteConstraintPrimaryKey:
+		return store.ErrDuplicate
+	case sqliteConstraintForeignKey:
+		return store.ErrConflict
+	}
+
+	return err
+}
+
+// isRetryable reports whether transaction failed only because the database was locked by another one
+func isRetryable(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	code := sqliteErr.Code() & sqlitePrimaryResultCodesMask
+	return code == sqliteBusy || code == sqliteLocked
+}
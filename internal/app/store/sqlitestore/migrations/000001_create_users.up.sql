@@ -0,0 +1,12 @@
+-- emails are stored normalized, but uniqueness is still checked case-insensitively like in postgres
+CREATE TABLE users (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    email text NOT NULL,
+    encrypted_password text NOT NULL,
+    is_admin boolean NOT NULL DEFAULT false,
+    avatar_url text NOT NULL DEFAULT '',
+    erased_at datetime,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE UNIQUE INDEX users_email_lower_idx ON users (lower(email));
@@ -0,0 +1,13 @@
+CREATE TABLE organizations (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    name text NOT NULL
+);
+
+CREATE TABLE memberships (
+    organization_id integer NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role text NOT NULL,
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX memberships_user_id_idx ON memberships (user_id);
@@ -0,0 +1,12 @@
+CREATE TABLE invitations (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    organization_id integer NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    email text NOT NULL,
+    role text NOT NULL,
+    invited_by integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at datetime NOT NULL,
+    accepted_at datetime
+);
+
+CREATE INDEX invitations_organization_id_idx ON invitations (organization_id);
+CREATE INDEX invitations_email_idx ON invitations (email);
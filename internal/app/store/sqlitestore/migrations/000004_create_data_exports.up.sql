@@ -0,0 +1,11 @@
+CREATE TABLE data_exports (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    status text NOT NULL,
+    blob_key text NOT NULL DEFAULT '',
+    error text NOT NULL DEFAULT '',
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at datetime
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports (user_id);
@@ -0,0 +1,4 @@
+CREATE TABLE settings (
+    name text NOT NULL PRIMARY KEY,
+    value text NOT NULL
+);
@@ -0,0 +1,8 @@
+CREATE TABLE user_certificates (
+    subject text NOT NULL PRIMARY KEY CHECK (
+        subject LIKE 'dn:%' OR subject LIKE 'dns:%' OR subject LIKE 'email:%' OR subject LIKE 'uri:%'
+    ),
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX user_certificates_user_id_idx ON user_certificates (user_id);
@@ -0,0 +1,54 @@
+package sqlitestore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+	"github.com/gopherschool/http-rest-api/internal/app/store/sqlitestore"
+)
+
+func TestOrganizationRepository_FindByID(t *testing.T) {
+	t.Parallel()
+
+	db := sqlitestore.TestDB(t)
+	ctx := context.Background()
+	s := sqlitestore.NewStore(db)
+	_, err := s.Organization().FindByID(ctx, 1)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	o := &models.Organization{Name: "Acme"}
+	assert.NoError(t, s.Organization().Create(ctx, o))
+	found, err := s.Organization().FindByID(ctx, o.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Acme", found.Name)
+}
+
+func TestMembershipRepository(t *testing.T) {
+	t.Parallel()
+
+	db := sqlitestore.TestDB(t)
+	ctx := context.Background()
+	s := sqlitestore.NewStore(db)
+	u := models.TestUser(t)
+	assert.NoError(t, s.User().Create(ctx, u))
+	o := &models.Organization{Name: "Acme"}
+	assert.NoError(t, s.Organization().Create(ctx, o))
+
+	m := &models.Membership{OrganizationID: o.ID, UserID: u.ID, Role: models.RoleMember}
+	assert.NoError(t, s.Membership().Create(ctx, m))
+	assert.ErrorIs(t, s.Membership().Create(ctx, m), store.ErrDuplicate)
+	assert.ErrorIs(t, s.Membership().Create(ctx, &models.Membership{OrganizationID: o.ID + 1, UserID: u.ID, Role: models.RoleMember}), store.ErrConflict)
+
+	m.Role = models.RoleAdmin
+	assert.NoError(t, s.Membership().UpdateRole(ctx, m))
+	members, err := s.Membership().ListByOrganization(ctx, o.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, members, 1) {
+		assert.Equal(t, models.RoleAdmin, members[0].Role)
+		assert.Equal(t, u.Email, members[0].Email)
+	}
+}
@@ -0,0 +1,215 @@
+// Package sqlitestore keeps data in a single SQLite file. It's meant for local development
+// and small deployments which don't want to run postgres, see sqlstore for the main implementation
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"net/url"
+	"strings"
+	"time"
+
+	_ "github.com/glebarez/go-sqlite" // pure Go driver, registered as "sqlite"
+
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+	"github.com/gopherschool/http-rest-api/internal/app/store/sqlrepo"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations returns schema migrations of SQLite database, they differ from postgres ones in migrations package
+func Migrations() fs.FS {
+	fsys, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		panic(err)
+	}
+
+	return fsys
+}
+
+// URLScheme selects this store in database URL, e.g. sqlite://data/restapi.db or sqlite:///var/lib/restapi.db
+const URLScheme = "sqlite://"
+
+// IsURL reports whether databaseURL points to SQLite database
+func IsURL(databaseURL string) bool {
+	return strings.HasPrefix(databaseURL, URLScheme)
+}
+
+// Open opens SQLite database from sqlite:// URL. Foreign keys are off in SQLite by default,
+// so they are turned on for every connection. Transactions take the write lock at once,
+// otherwise two transactions which read first and write later would fail with SQLITE_BUSY
+func Open(databaseURL string) (*sql.DB, error) {
+	path := strings.TrimPrefix(databaseURL, URLScheme)
+	params := url.Values{}
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		var err error
+		if params, err = url.ParseQuery(path[i+1:]); err != nil {
+			return nil, err
+		}
+
+		path = path[:i]
+	}
+
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	// every connection to :memory: has its own empty database
+	if path == ":memory:" {
+		db.SetMaxOpenConns(1)
+	}
+
+	return db, nil
+}
+
+type Store struct {
+	db                     *sql.DB
+	tx                     *sql.Tx // not nil for stores created by WithTx
+	queryTimeout           time.Duration
+	userRepository         *sqlrepo.UserRepository
+	organizationRepository *sqlrepo.OrganizationRepository
+	membershipRepository   *sqlrepo.MembershipRepository
+	invitationRepository   *sqlrepo.InvitationRepository
+	dataExportRepository   *sqlrepo.DataExportRepository
+	settingRepository      *sqlrepo.SettingRepository
+}
+
+// NewStore returns store which works with db opened by Open. Repositories are created at once,
+// so concurrent calls of User() and others don't race
+func NewStore(db *sql.DB) *Store {
+	return newStore(db, nil, 0)
+}
+
+// newStore returns store with repositories working with tx if it's not nil and with db otherwise
+func newStore(db *sql.DB, tx *sql.Tx, queryTimeout time.Duration) *Store {
+	s := &Store{db: db, tx: tx, queryTimeout: queryTimeout}
+	s.userRepository = sqlrepo.NewUserRepository(conn{s}, dialect)
+	s.organizationRepository = sqlrepo.NewOrganizationRepository(conn{s}, dialect)
+	s.membershipRepository = sqlrepo.NewMembershipRepository(conn{s}, dialect)
+	s.invitationRepository = sqlrepo.NewInvitationRepository(conn{s}, dialect)
+	s.dataExportRepository = sqlrepo.NewDataExportRepository(conn{s}, dialect)
+	s.settingRepository = sqlrepo.NewSettingRepository(conn{s}, dialect)
+	return s
+}
+
+// SetQueryTimeout limits duration of every single query, zero means no limit
+func (s *Store) SetQueryTimeout(d time.Duration) {
+	s.queryTimeout = d
+}
+
+// User returns repository of users
+func (s *Store) User() store.UserRepository {
+	return s.userRepository
+}
+
+// Organization returns repository of organizations
+func (s *Store) Organization() store.OrganizationRepository {
+	return s.organizationRepository
+}
+
+// Membership returns repository which links users and organizations
+func (s *Store) Membership() store.MembershipRepository {
+	return s.membershipRepository
+}
+
+// Invitation returns repository of invitations to organizations
+func (s *Store) Invitation() store.InvitationRepository {
+	return s.invitationRepository
+}
+
+// DataExport returns repository of personal data exports
+func (s *Store) DataExport() store.DataExportRepository {
+	return s.dataExportRepository
+}
+
+// Setting returns repository of settings fixed for the database
+func (s *Store) Setting() store.SettingRepository {
+	return s.settingRepository
+}
+
+// txRetryDelay is multiplied by attempt number, so concurrent transactions don't collide again at once
+const txRetryDelay = 10 * time.Millisecond
+
+// WithTx works like sqlstore.Store.WithTx. SQLite transactions are always serializable,
+// so opts.Isolation is ignored. Transactions which failed because the database was busy are retried
+func (s *Store) WithTx(ctx context.Context, opts *store.TxOptions, fn func(store.Store) error) error {
+	// nested calls just join the outer transaction
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	if opts == nil {
+		opts = &store.TxOptions{MaxRetries: store.DefaultTxMaxRetries}
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := s.runTx(ctx, opts, fn)
+		if err == nil || !isRetryable(err) || attempt > opts.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * txRetryDelay):
+		}
+	}
+}
+
+// runTx is one attempt of WithTx. Panic in fn rolls the transaction back and goes further
+func (s *Store) runTx(ctx context.Context, opts *store.TxOptions, fn func(store.Store) error) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(newStore(s.db, tx, s.queryTimeout)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Ping checks connection to the primary database
+func (s *Store) Ping(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.db.PingContext(ctx)
+}
+
+// querier returns transaction if store is bound to it and plain connection pool otherwise
+func (s *Store) querier() sqlrepo.Querier {
+	if s.tx != nil {
+		return s.tx
+	}
+
+	return s.db
+}
+
+// withTimeout applies query timeout to ctx. Returned function must be called when the query
+// and reading of its results are finished
+func (s *Store) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
@@ -0,0 +1,53 @@
+package sqlitestore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+	"github.com/gopherschool/http-rest-api/internal/app/store/sqlitestore"
+	"github.com/gopherschool/http-rest-api/internal/app/store/storetest"
+)
+
+func TestStore_WithTx(t *testing.T) {
+	t.Parallel()
+
+	db := sqlitestore.TestDB(t)
+	ctx := context.Background()
+	s := sqlitestore.NewStore(db)
+	errFailed := errors.New("failed")
+
+	err := s.WithTx(ctx, nil, func(tx store.Store) error {
+		assert.NoError(t, tx.User().Create(ctx, models.TestUser(t)))
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+	_, err = s.User().FindByEmail(ctx, "user@example.org")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	assert.Panics(t, func() {
+		s.WithTx(ctx, nil, func(tx store.Store) error {
+			tx.User().Create(ctx, models.TestUser(t))
+			panic("boom")
+		})
+	})
+	_, err = s.User().FindByEmail(ctx, "user@example.org")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	err = s.WithTx(ctx, &store.TxOptions{Isolation: store.IsolationSerializable}, func(tx store.Store) error {
+		return tx.User().Create(ctx, models.TestUser(t))
+	})
+	assert.NoError(t, err)
+	_, err = s.User().FindByEmail(ctx, "user@example.org")
+	assert.NoError(t, err)
+}
+
+func TestStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return sqlitestore.NewStore(sqlitestore.TestDB(t))
+	})
+}
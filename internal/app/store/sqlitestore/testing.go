@@ -0,0 +1,34 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/gopherschool/http-rest-api/internal/app/migrate"
+)
+
+// TestDB is a helper for tests. It creates database in a temporary directory and applies all migrations,
+// so tests don't share any data and may run in parallel. The database is removed when the test finishes
+func TestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := Open(URLScheme + filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	m, err := migrate.New(db, Migrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.WithoutLock().Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
@@ -0,0 +1,139 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+type DataExportRepository struct {
+	db      DB
+	dialect *Dialect
+}
+
+// dataExportColumns are selected by every query which returns exports, see scanDataExport
+const dataExportColumns = "id, user_id, status, blob_key, error, created_at, completed_at"
+
+func scanDataExport(row rowScanner) (*models.DataExport, error) {
+	e := &models.DataExport{}
+	if err := row.Scan(
+		&e.ID,
+		&e.UserID,
+		&e.Status,
+		&e.BlobKey,
+		&e.Error,
+		&e.CreatedAt,
+		&e.CompletedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, store.ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (r *DataExportRepository) Create(ctx context.Context, e *models.DataExport) error {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	if r.dialect.SetCreatedAt {
+		e.CreatedAt = time.Now()
+		err := r.db.Writer(ctx).QueryRowContext(
+			ctx,
+			"INSERT INTO data_exports (user_id, status, created_at) VALUES ($1, $2, $3) RETURNING id",
+			e.UserID,
+			e.Status,
+			e.CreatedAt,
+		).Scan(&e.ID)
+		return r.dialect.TranslateError(err)
+	}
+
+	err := r.db.Writer(ctx).QueryRowContext(
+		ctx,
+		"INSERT INTO data_exports (user_id, status) VALUES ($1, $2) RETURNING id, created_at",
+		e.UserID,
+		e.Status,
+	).Scan(&e.ID, &e.CreatedAt)
+	return r.dialect.TranslateError(err)
+}
+
+func (r *DataExportRepository) FindByID(ctx context.Context, id int) (*models.DataExport, error) {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	return scanDataExport(r.db.Reader(ctx).QueryRowContext(
+		ctx,
+		"SELECT "+dataExportColumns+" FROM data_exports WHERE id = $1",
+		id,
+	))
+}
+
+func (r *DataExportRepository) Update(ctx context.Context, e *models.DataExport) error {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	res, err := r.db.Writer(ctx).ExecContext(
+		ctx,
+		"UPDATE data_exports SET status = $1, blob_key = $2, error = $3, completed_at = $4 WHERE id = $5",
+		e.Status,
+		e.BlobKey,
+		e.Error,
+		e.CompletedAt,
+		e.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return store.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *DataExportRepository) ListByUser(ctx context.Context, userID int) ([]*models.DataExport, error) {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Reader(ctx).QueryContext(
+		ctx,
+		"SELECT "+dataExportColumns+" FROM data_exports WHERE user_id = $1 ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := []*models.DataExport{}
+	for rows.Next() {
+		e, err := scanDataExport(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		exports = append(exports, e)
+	}
+
+	return exports, rows.Err()
+}
+
+func (r *DataExportRepository) DeleteByUser(ctx context.Context, userID int) error {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Writer(ctx).ExecContext(ctx, "DELETE FROM data_exports WHERE user_id = $1", userID)
+	return err
+}
@@ -0,0 +1,143 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+type InvitationRepository struct {
+	db      DB
+	dialect *Dialect
+}
+
+func (r *InvitationRepository) Create(ctx context.Context, i *models.Invitation) error {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	if err := i.Validate(); err != nil {
+		return err
+	}
+
+	if err := i.BeforeCreate(); err != nil {
+		return err
+	}
+
+	if err := r.db.Writer(ctx).QueryRowContext(
+		ctx,
+		`INSERT INTO invitations (organization_id, email, role, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		i.OrganizationID,
+		i.Email,
+		i.Role,
+		i.InvitedBy,
+		i.ExpiresAt,
+	).Scan(&i.ID); err != nil {
+		return r.dialect.TranslateError(err)
+	}
+
+	return nil
+}
+
+// invitationColumns are selected by every query which returns invitations, see scanInvitation
+const invitationColumns = "id, organization_id, email, role, invited_by, expires_at, accepted_at"
+
+func scanInvitation(row rowScanner) (*models.Invitation, error) {
+	i := &models.Invitation{}
+	if err := row.Scan(
+		&i.ID,
+		&i.OrganizationID,
+		&i.Email,
+		&i.Role,
+		&i.InvitedBy,
+		&i.ExpiresAt,
+		&i.AcceptedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, store.ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func (r *InvitationRepository) FindByID(ctx context.Context, id int) (*models.Invitation, error) {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	return scanInvitation(r.db.Reader(ctx).QueryRowContext(
+		ctx,
+		"SELECT "+invitationColumns+" FROM invitations WHERE id = $1",
+		id,
+	))
+}
+
+func (r *InvitationRepository) ListByEmail(ctx context.Context, email string) ([]*models.Invitation, error) {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Reader(ctx).QueryContext(
+		ctx,
+		"SELECT "+invitationColumns+" FROM invitations WHERE email = $1 ORDER BY id",
+		models.NormalizeEmail(email),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*models.Invitation{}
+	for rows.Next() {
+		i, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		invitations = append(invitations, i)
+	}
+
+	return invitations, rows.Err()
+}
+
+func (r *InvitationRepository) DeleteByEmail(ctx context.Context, email string) error {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Writer(ctx).ExecContext(ctx, "DELETE FROM invitations WHERE email = $1", models.NormalizeEmail(email))
+	return err
+}
+
+// MarkAccepted updates only not accepted invitations, so the same invitation can't be used twice
+// even by concurrent requests
+func (r *InvitationRepository) MarkAccepted(ctx context.Context, i *models.Invitation) error {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	res, err := r.db.Writer(ctx).ExecContext(
+		ctx,
+		"UPDATE invitations SET accepted_at = $1 WHERE id = $2 AND accepted_at IS NULL",
+		now,
+		i.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return store.ErrConflict
+	}
+
+	i.AcceptedAt = &now
+	return nil
+}
@@ -0,0 +1,150 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+type MembershipRepository struct {
+	db      DB
+	dialect *Dialect
+}
+
+// Create attaches user to organization. Primary key and foreign keys of memberships table
+// are translated to store.ErrDuplicate and store.ErrConflict
+func (r *MembershipRepository) Create(ctx context.Context, m *models.Membership) error {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := r.db.Writer(ctx).ExecContext(
+		ctx,
+		"INSERT INTO memberships (organization_id, user_id, role) VALUES ($1, $2, $3)",
+		m.OrganizationID,
+		m.UserID,
+		m.Role,
+	); err != nil {
+		return r.dialect.TranslateError(err)
+	}
+
+	return nil
+}
+
+func (r *MembershipRepository) Find(ctx context.Context, organizationID, userID int) (*models.Membership, error) {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	m := &models.Membership{}
+	if err := r.db.Reader(ctx).QueryRowContext(
+		ctx,
+		`SELECT m.organization_id, m.user_id, m.role, u.email
+		FROM memberships m JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1 AND m.user_id = $2`,
+		organizationID,
+		userID,
+	).Scan(
+		&m.OrganizationID,
+		&m.UserID,
+		&m.Role,
+		&m.Email,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, store.ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (r *MembershipRepository) ListByOrganization(ctx context.Context, organizationID int) ([]*models.Membership, error) {
+	return r.queryMemberships(
+		ctx,
+		`SELECT m.organization_id, m.user_id, m.role, u.email
+		FROM memberships m JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1
+		ORDER BY m.user_id`,
+		organizationID,
+	)
+}
+
+func (r *MembershipRepository) ListByUser(ctx context.Context, userID int) ([]*models.Membership, error) {
+	return r.queryMemberships(
+		ctx,
+		`SELECT m.organization_id, m.user_id, m.role, u.email
+		FROM memberships m JOIN users u ON u.id = m.user_id
+		WHERE m.user_id = $1
+		ORDER BY m.organization_id`,
+		userID,
+	)
+}
+
+func (r *MembershipRepository) DeleteByUser(ctx context.Context, userID int) error {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Writer(ctx).ExecContext(ctx, "DELETE FROM memberships WHERE user_id = $1", userID)
+	return err
+}
+
+// queryMemberships runs query which selects organization_id, user_id, role and email
+func (r *MembershipRepository) queryMemberships(ctx context.Context, query string, args ...interface{}) ([]*models.Membership, error) {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Reader(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*models.Membership{}
+	for rows.Next() {
+		m := &models.Membership{}
+		if err := rows.Scan(&m.OrganizationID, &m.UserID, &m.Role, &m.Email); err != nil {
+			return nil, err
+		}
+
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+func (r *MembershipRepository) UpdateRole(ctx context.Context, m *models.Membership) error {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	res, err := r.db.Writer(ctx).ExecContext(
+		ctx,
+		"UPDATE memberships SET role = $1 WHERE organization_id = $2 AND user_id = $3",
+		m.Role,
+		m.OrganizationID,
+		m.UserID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return store.ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+type OrganizationRepository struct {
+	db      DB
+	dialect *Dialect
+}
+
+// Create validates organization and saves it with a new ID
+func (r *OrganizationRepository) Create(ctx context.Context, o *models.Organization) error {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	return r.db.Writer(ctx).QueryRowContext(
+		ctx,
+		"INSERT INTO organizations (name) VALUES ($1) RETURNING id",
+		o.Name,
+	).Scan(&o.ID)
+}
+
+func (r *OrganizationRepository) FindByID(ctx context.Context, id int) (*models.Organization, error) {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	o := &models.Organization{}
+	if err := r.db.Reader(ctx).QueryRowContext(
+		ctx,
+		"SELECT id, name FROM organizations WHERE id = $1",
+		id,
+	).Scan(
+		&o.ID,
+		&o.Name,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, store.ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// Delete relies on foreign keys of memberships and invitations, they are deleted by cascade
+func (r *OrganizationRepository) Delete(ctx context.Context, id int) error {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Writer(ctx).ExecContext(ctx, "DELETE FROM organizations WHERE id = $1", id)
+	return err
+}
@@ -0,0 +1,39 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+type SettingRepository struct {
+	db      DB
+	dialect *Dialect
+}
+
+// Create saves setting once, primary key on name turns into store.ErrDuplicate
+func (r *SettingRepository) Create(ctx context.Context, name, value string) error {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Writer(ctx).ExecContext(ctx, "INSERT INTO settings (name, value) VALUES ($1, $2)", name, value)
+	return r.dialect.TranslateError(err)
+}
+
+func (r *SettingRepository) Find(ctx context.Context, name string) (string, error) {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	// settings are checked before anything is written, a lagging replica must not hide them
+	var value string
+	if err := r.db.Writer(ctx).QueryRowContext(ctx, "SELECT value FROM settings WHERE name = $1", name).Scan(&value); err != nil {
+		if err == sql.ErrNoRows {
+			return "", store.ErrRecordNotFound
+		}
+
+		return "", err
+	}
+
+	return value, nil
+}
@@ -0,0 +1,80 @@
+// Package sqlrepo implements repositories on top of database/sql for both sqlstore and sqlitestore.
+// Queries are written in SQL which postgres and SQLite understand the same way,
+// everything they do differently is described by Dialect
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// Querier is implemented by both *sql.DB and *sql.Tx, so repositories don't care where they run
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// DB gives repositories connections of the store they belong to
+type DB interface {
+	// Reader returns where read-only queries go, it may be a replica
+	Reader(ctx context.Context) Querier
+	// Writer returns where writes go, i.e. the primary database or the transaction
+	Writer(ctx context.Context) Querier
+	// WithTimeout applies query timeout of the store to ctx
+	WithTimeout(ctx context.Context) (context.Context, context.CancelFunc)
+}
+
+// Dialect describes what differs between databases
+type Dialect struct {
+	// TranslateError maps driver specific errors to store errors
+	TranslateError func(error) error
+	// SearchUsers returns query which selects UserColumns of users matching query, best matches first,
+	// and its arguments. See store.UserRepository.Search
+	SearchUsers func(query string, limit, offset int) (string, []interface{})
+	// SetCreatedAt makes repositories set created_at columns themselves
+	// for databases whose CURRENT_TIMESTAMP is not precise enough
+	SetCreatedAt bool
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// EscapeLike escapes LIKE wildcards, so they are matched literally. Backslash is the default escape
+// character of postgres, SQLite has none and its queries must set it with ESCAPE '\'
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// NewUserRepository returns repository of users which runs queries on db
+func NewUserRepository(db DB, dialect *Dialect) *UserRepository {
+	return &UserRepository{db: db, dialect: dialect}
+}
+
+// NewOrganizationRepository returns repository of organizations which runs queries on db
+func NewOrganizationRepository(db DB, dialect *Dialect) *OrganizationRepository {
+	return &OrganizationRepository{db: db, dialect: dialect}
+}
+
+// NewMembershipRepository returns repository of memberships which runs queries on db
+func NewMembershipRepository(db DB, dialect *Dialect) *MembershipRepository {
+	return &MembershipRepository{db: db, dialect: dialect}
+}
+
+// NewInvitationRepository returns repository of invitations which runs queries on db
+func NewInvitationRepository(db DB, dialect *Dialect) *InvitationRepository {
+	return &InvitationRepository{db: db, dialect: dialect}
+}
+
+// NewDataExportRepository returns repository of data exports which runs queries on db
+func NewDataExportRepository(db DB, dialect *Dialect) *DataExportRepository {
+	return &DataExportRepository{db: db, dialect: dialect}
+}
+
+// NewSettingRepository returns repository of settings which runs queries on db
+func NewSettingRepository(db DB, dialect *Dialect) *SettingRepository {
+	return &SettingRepository{db: db, dialect: dialect}
+}
@@ -0,0 +1,251 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// UserColumns are selected by every query which returns users, see scanUser
+const UserColumns = "id, email, encrypted_password, is_admin, avatar_url, erased_at, version"
+
+type UserRepository struct {
+	db      DB
+	dialect *Dialect
+}
+
+// scanUser fills user with UserColumns in the same order
+func scanUser(row rowScanner) (*models.User, error) {
+	u := &models.User{}
+	if err := row.Scan(
+		&u.ID,
+		&u.Email,
+		&u.EncryptedPassword,
+		&u.IsAdmin,
+		&u.AvatarURL,
+		&u.ErasedAt,
+		&u.Version,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, store.ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// Create accepts and returns needed model
+func (r *UserRepository) Create(ctx context.Context, u *models.User) error {
+	// check if user is valid. if OK - run BeforeCreate callback
+	if err := u.Validate(); err != nil {
+		return err
+	}
+
+	if err := u.BeforeCreate(); err != nil {
+		return err
+	}
+
+	// hashing of password above is not a query, so the timeout starts here
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	// RETURNING gives back the ID of successfully created user, both postgres and SQLite support it.
+	// Scan method is used to map returned string to passed arguments (should be pointers!)
+	if err := r.db.Writer(ctx).QueryRowContext(
+		ctx,
+		"INSERT INTO users (email, encrypted_password, is_admin) VALUES ($1, $2, $3) RETURNING id, version",
+		u.Email,
+		u.EncryptedPassword,
+		u.IsAdmin,
+	).Scan(&u.ID, &u.Version); err != nil {
+		// unique index on email turns into store.ErrDuplicate here
+		return r.dialect.TranslateError(err)
+	}
+
+	return nil
+}
+
+// FindByEmail method is needed for authorization to find user
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	// QueryRow returns only one result
+	return scanUser(r.db.Reader(ctx).QueryRowContext(
+		ctx,
+		// lower() matches the unique index on users, see migrations/000002_users_email_lower.up.sql
+		// and migrations/000001_create_users.up.sql of sqlitestore
+		"SELECT "+UserColumns+" FROM users WHERE lower(email) = lower($1)",
+		models.NormalizeEmail(email),
+	))
+}
+
+func (r *UserRepository) FindByID(ctx context.Context, id int) (*models.User, error) {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	return scanUser(r.db.Reader(ctx).QueryRowContext(
+		ctx,
+		"SELECT "+UserColumns+" FROM users WHERE id = $1",
+		id,
+	))
+}
+
+// Update is used by profile editing. Unique index on email turns into store.ErrDuplicate here
+func (r *UserRepository) Update(ctx context.Context, u *models.User) error {
+	return r.update(
+		ctx,
+		u,
+		"email = $1, encrypted_password = $2, is_admin = $3",
+		u.Email,
+		u.EncryptedPassword,
+		u.IsAdmin,
+	)
+}
+
+// UpdateEncryptedPassword is used to replace legacy password hashes after login
+func (r *UserRepository) UpdateEncryptedPassword(ctx context.Context, u *models.User) error {
+	return r.update(ctx, u, "encrypted_password = $1", u.EncryptedPassword)
+}
+
+// UpdateAvatarURL is called after new avatar is uploaded
+func (r *UserRepository) UpdateAvatarURL(ctx context.Context, u *models.User) error {
+	return r.update(ctx, u, "avatar_url = $1", u.AvatarURL)
+}
+
+// Anonymize erases personal data, see models.User.Anonymize
+func (r *UserRepository) Anonymize(ctx context.Context, u *models.User) error {
+	u.Anonymize(time.Now())
+	return r.update(
+		ctx,
+		u,
+		"email = $1, encrypted_password = $2, avatar_url = $3, is_admin = $4, erased_at = $5",
+		u.Email,
+		u.EncryptedPassword,
+		u.AvatarURL,
+		u.IsAdmin,
+		u.ErasedAt,
+	)
+}
+
+// AddCertificateSubject maps typed client certificate name to user, see models.CertificateDN
+// and certificateUser in apiserver
+func (r *UserRepository) AddCertificateSubject(ctx context.Context, userID int, subject string) error {
+	if err := models.ValidateCertificateSubject(subject); err != nil {
+		return err
+	}
+
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Writer(ctx).ExecContext(
+		ctx,
+		"INSERT INTO user_certificates (subject, user_id) VALUES ($1, $2)",
+		subject,
+		userID,
+	)
+
+	// primary key on subject turns into store.ErrDuplicate, missing user into store.ErrConflict
+	return r.dialect.TranslateError(err)
+}
+
+// FindByCertificateSubject returns user mapped to typed certificate name. Names are compared exactly,
+// including their type, so a name matches only mappings of the same type
+func (r *UserRepository) FindByCertificateSubject(ctx context.Context, subject string) (*models.User, error) {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	return scanUser(r.db.Reader(ctx).QueryRowContext(
+		ctx,
+		"SELECT "+UserColumns+" FROM users WHERE id = (SELECT user_id FROM user_certificates WHERE subject = $1)",
+		subject,
+	))
+}
+
+// update sets columns of one user if it still has u.Version and increments the version.
+// set uses placeholders starting from $1 for args. Returns store.ErrConflict if user was changed
+// since it was loaded and store.ErrRecordNotFound if there is no such user
+func (r *UserRepository) update(ctx context.Context, u *models.User, set string, args ...interface{}) error {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	query := fmt.Sprintf(
+		"UPDATE users SET %s, version = version + 1 WHERE id = $%d AND version = $%d RETURNING version",
+		set,
+		len(args)+1,
+		len(args)+2,
+	)
+
+	err := r.db.Writer(ctx).QueryRowContext(ctx, query, append(args, u.ID, u.Version)...).Scan(&u.Version)
+	if err != sql.ErrNoRows {
+		return r.dialect.TranslateError(err)
+	}
+
+	// nothing is updated, either the user is gone or it has another version
+	var exists bool
+	if err := r.db.Writer(ctx).QueryRowContext(
+		ctx,
+		"SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)",
+		u.ID,
+	).Scan(&exists); err != nil {
+		return err
+	}
+
+	if exists {
+		return store.ErrConflict
+	}
+
+	return store.ErrRecordNotFound
+}
+
+// List is used for export, so users are returned in stable order (by ID)
+func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*models.User, error) {
+	return r.queryUsers(
+		ctx,
+		"SELECT "+UserColumns+" FROM users ORDER BY id LIMIT $1 OFFSET $2",
+		limit,
+		offset,
+	)
+}
+
+// Search ranking depends on the indexes database has, so the query comes from the dialect
+func (r *UserRepository) Search(ctx context.Context, query string, limit, offset int) ([]*models.User, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return []*models.User{}, nil
+	}
+
+	q, args := r.dialect.SearchUsers(query, limit, offset)
+	return r.queryUsers(ctx, q, args...)
+}
+
+// queryUsers runs query which selects UserColumns
+func (r *UserRepository) queryUsers(ctx context.Context, query string, args ...interface{}) ([]*models.User, error) {
+	ctx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Reader(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
@@ -0,0 +1,63 @@
+package sqlstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+	"github.com/gopherschool/http-rest-api/internal/app/store/sqlstore"
+)
+
+func TestDataExportRepository(t *testing.T) {
+	t.Parallel()
+
+	db := sqlstore.TestDB(t, databaseURL)
+	ctx := context.Background()
+	s := sqlstore.NewStore(db)
+	u := models.TestUser(t)
+	s.User().Create(ctx, u)
+
+	e := &models.DataExport{UserID: u.ID, Status: models.DataExportPending}
+	assert.NoError(t, s.DataExport().Create(ctx, e))
+	assert.ErrorIs(t, s.DataExport().Create(ctx, &models.DataExport{UserID: u.ID + 1, Status: models.DataExportPending}), store.ErrConflict)
+
+	e.Status = models.DataExportCompleted
+	e.BlobKey = "exports/1/1.zip"
+	assert.NoError(t, s.DataExport().Update(ctx, e))
+
+	found, err := s.DataExport().FindByID(ctx, e.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.DataExportCompleted, found.Status)
+
+	exports, err := s.DataExport().ListByUser(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, exports, 1)
+
+	assert.NoError(t, s.DataExport().DeleteByUser(ctx, u.ID))
+	_, err = s.DataExport().FindByID(ctx, e.ID)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+}
+
+func TestUserRepository_Anonymize(t *testing.T) {
+	t.Parallel()
+
+	db := sqlstore.TestDB(t, databaseURL)
+	ctx := context.Background()
+	s := sqlstore.NewStore(db)
+	u := models.TestUser(t)
+	s.User().Create(ctx, u)
+
+	assert.NoError(t, s.User().Anonymize(ctx, u))
+	assert.True(t, u.IsErased())
+
+	_, err := s.User().FindByEmail(ctx, "user@example.org")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	found, err := s.User().FindByID(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.True(t, found.IsErased())
+	assert.Empty(t, found.EncryptedPassword)
+}
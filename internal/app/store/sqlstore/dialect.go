@@ -0,0 +1,71 @@
+package sqlstore
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gopherschool/http-rest-api/internal/app/store/sqlrepo"
+)
+
+// dialect is what sqlrepo repositories need to know about postgres
+var dialect = &sqlrepo.Dialect{
+	TranslateError: translateError,
+	SearchUsers:    searchUsers,
+}
+
+// conn gives sqlrepo repositories connections of the store: reads may go to replicas
+type conn struct {
+	s *Store
+}
+
+func (c conn) Reader(ctx context.Context) sqlrepo.Querier {
+	return c.s.reader(ctx)
+}
+
+func (c conn) Writer(ctx context.Context) sqlrepo.Querier {
+	return c.s.writer(ctx)
+}
+
+func (c conn) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return c.s.withTimeout(ctx)
+}
+
+// searchUsers finds users whose email contains query or has a word starting with it.
+// Trigram and full-text indexes are created in migrations/000005_users_search.up.sql.
+// Best matches go first: emails starting with query, then by full-text rank and trigram similarity
+func searchUsers(query string, limit, offset int) (string, []interface{}) {
+	return `SELECT ` + sqlrepo.UserColumns + ` FROM users
+		WHERE lower(email) LIKE '%' || $1 || '%'
+			OR lower(email) % $2
+			OR ` + emailDocument + ` @@ to_tsquery('simple', $3)
+		ORDER BY
+			lower(email) LIKE $1 || '%' DESC,
+			ts_rank(` + emailDocument + `, to_tsquery('simple', $3)) DESC,
+			similarity(lower(email), $2) DESC,
+			id
+		LIMIT $4 OFFSET $5`,
+		[]interface{}{sqlrepo.EscapeLike(query), query, prefixTSQuery(query), limit, offset}
+}
+
+// emailDocument splits email into words, so "john.smith@example.org" can be found by "smi".
+// Must be the same expression as in the full-text index
+const emailDocument = `to_tsvector('simple', translate(lower(email), '@.+_-', '     '))`
+
+// prefixTSQuery turns "john smi" into "john:* & smi:*". Only letters and digits are kept,
+// so user input can't break to_tsquery syntax
+func prefixTSQuery(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+
+	if len(words) == 0 {
+		// matches nothing, but is still a valid tsquery
+		return "''"
+	}
+
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+
+	return strings.Join(words, " & ")
+}
@@ -0,0 +1,47 @@
+package sqlstore
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// Postgres error codes we care about. Full list: https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pqUniqueViolation      = pq.ErrorCode("23505")
+	pqForeignKeyViolation  = pq.ErrorCode("23503")
+	pqExclusionViolation   = pq.ErrorCode("23P01")
+	pqSerializationFailure = pq.ErrorCode("40001")
+	pqDeadlockDetected     = pq.ErrorCode("40P01")
+)
+
+// translateError maps driver specific errors to store errors,
+// so the handlers never see (and never leak) raw postgres messages
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch pqErr.Code {
+	case pqUniqueViolation:
+		return store.ErrDuplicate
+	case pqForeignKeyViolation, pqExclusionViolation:
+		return store.ErrConflict
+	}
+
+	return err
+}
+
+// isRetryable reports whether transaction failed only because of concurrent ones
+// and may succeed if it's run again
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	return pqErr.Code == pqSerializationFailure || pqErr.Code == pqDeadlockDetected
+}
@@ -0,0 +1,93 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+	"github.com/gopherschool/http-rest-api/internal/app/store/sqlrepo"
+)
+
+// replica is a read-only copy of the primary database
+type replica struct {
+	db      *sql.DB
+	healthy int32 // set by CheckReplicas, replicas are not used until the first successful check
+}
+
+// SetReplicas makes read-only methods use replicas, writes always go to the primary.
+// Replicas are not used until CheckReplicas finds them healthy
+func (s *Store) SetReplicas(dbs ...*sql.DB) {
+	s.replicas = make([]*replica, len(dbs))
+	for i, db := range dbs {
+		s.replicas[i] = &replica{db: db}
+	}
+}
+
+// CheckReplicas pings every replica and remembers which of them can be used
+func (s *Store) CheckReplicas(ctx context.Context, timeout time.Duration) {
+	for _, r := range s.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		healthy := int32(0)
+		if err := r.db.PingContext(pingCtx); err == nil {
+			healthy = 1
+		}
+		cancel()
+
+		atomic.StoreInt32(&r.healthy, healthy)
+	}
+}
+
+// WatchReplicas runs CheckReplicas every interval until ctx is done
+func (s *Store) WatchReplicas(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// a replica which doesn't answer in half of the interval is too slow anyway
+			s.CheckReplicas(ctx, interval/2)
+		}
+	}
+}
+
+// HealthyReplicas returns number of replicas which passed the last check
+func (s *Store) HealthyReplicas() int {
+	n := 0
+	for _, r := range s.replicas {
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			n++
+		}
+	}
+
+	return n
+}
+
+// reader returns where read-only queries go: the transaction if store is bound to it, the primary
+// if something was already written with ctx (see store.WithWriteTracking), otherwise the next healthy
+// replica in round robin. Without healthy replicas the primary is used
+func (s *Store) reader(ctx context.Context) sqlrepo.Querier {
+	if s.tx != nil || len(s.replicas) == 0 || store.Written(ctx) {
+		return s.querier()
+	}
+
+	start := atomic.AddUint32(&s.nextReplica, 1)
+	for i := range s.replicas {
+		r := s.replicas[(int(start)+i)%len(s.replicas)]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			return r.db
+		}
+	}
+
+	return s.db
+}
+
+// writer returns querier for writes and remembers the write in ctx
+func (s *Store) writer(ctx context.Context) sqlrepo.Querier {
+	store.MarkWritten(ctx)
+	return s.querier()
+}
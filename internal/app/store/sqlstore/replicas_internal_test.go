@@ -0,0 +1,45 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+func TestStore_Reader(t *testing.T) {
+	// sql.Open doesn't connect, so nothing is needed for routing
+	open := func() *sql.DB {
+		db, err := sql.Open("postgres", "host=localhost")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+
+	primary, replica1, replica2 := open(), open(), open()
+	s := NewStore(primary)
+	ctx := store.WithWriteTracking(context.Background())
+	assert.Equal(t, primary, s.reader(ctx))
+
+	s.SetReplicas(replica1, replica2)
+	// not checked yet
+	assert.Equal(t, primary, s.reader(ctx))
+
+	s.replicas[1].healthy = 1
+	assert.Equal(t, replica2, s.reader(ctx))
+	assert.Equal(t, replica2, s.reader(ctx))
+
+	s.replicas[0].healthy = 1
+	assert.NotEqual(t, s.reader(ctx), s.reader(ctx))
+
+	// the request has written something, it must see its changes
+	assert.Equal(t, primary, s.writer(ctx))
+	assert.Equal(t, primary, s.reader(ctx))
+	assert.NotEqual(t, primary, s.reader(context.Background()))
+}
@@ -1,16 +1,28 @@
 package sqlstore
 
 import (
+	"context"
 	"database/sql"
+	"time"
 
 	_ "github.com/lib/pq" // Anonymous import to skip import of methods
 
 	"github.com/gopherschool/http-rest-api/internal/app/store"
+	"github.com/gopherschool/http-rest-api/internal/app/store/sqlrepo"
 )
 
 type Store struct {
-	db             *sql.DB
-	userRepository *UserRepository
+	db                     *sql.DB
+	tx                     *sql.Tx // not nil for stores created by WithTx
+	queryTimeout           time.Duration
+	replicas               []*replica
+	nextReplica            uint32 // round robin counter of reader
+	userRepository         *sqlrepo.UserRepository
+	organizationRepository *sqlrepo.OrganizationRepository
+	membershipRepository   *sqlrepo.MembershipRepository
+	invitationRepository   *sqlrepo.InvitationRepository
+	dataExportRepository   *sqlrepo.DataExportRepository
+	settingRepository      *sqlrepo.SettingRepository
 }
 
 // NewStore returns pointer on store
@@ -20,6 +32,12 @@ func NewStore(db *sql.DB) *Store {
 	}
 }
 
+// SetQueryTimeout limits duration of every single query, zero means no limit.
+// Deadline of the context passed to repositories is respected anyway
+func (s *Store) SetQueryTimeout(d time.Duration) {
+	s.queryTimeout = d
+}
+
 // User is special method to avoid using repositories without the store.
 // Example of such call: store.User().Create()
 func (s *Store) User() store.UserRepository {
@@ -27,6 +45,146 @@ func (s *Store) User() store.UserRepository {
 		return s.userRepository
 	}
 
-	s.userRepository = &UserRepository{store: s}
+	s.userRepository = sqlrepo.NewUserRepository(conn{s}, dialect)
 	return s.userRepository
 }
+
+// Organization returns repository of organizations, see User
+func (s *Store) Organization() store.OrganizationRepository {
+	if s.organizationRepository != nil {
+		return s.organizationRepository
+	}
+
+	s.organizationRepository = sqlrepo.NewOrganizationRepository(conn{s}, dialect)
+	return s.organizationRepository
+}
+
+// Membership returns repository which links users and organizations
+func (s *Store) Membership() store.MembershipRepository {
+	if s.membershipRepository != nil {
+		return s.membershipRepository
+	}
+
+	s.membershipRepository = sqlrepo.NewMembershipRepository(conn{s}, dialect)
+	return s.membershipRepository
+}
+
+// Invitation returns repository of invitations to organizations
+func (s *Store) Invitation() store.InvitationRepository {
+	if s.invitationRepository != nil {
+		return s.invitationRepository
+	}
+
+	s.invitationRepository = sqlrepo.NewInvitationRepository(conn{s}, dialect)
+	return s.invitationRepository
+}
+
+// DataExport returns repository of personal data exports
+func (s *Store) DataExport() store.DataExportRepository {
+	if s.dataExportRepository != nil {
+		return s.dataExportRepository
+	}
+
+	s.dataExportRepository = sqlrepo.NewDataExportRepository(conn{s}, dialect)
+	return s.dataExportRepository
+}
+
+// Setting returns repository of settings fixed for the database
+func (s *Store) Setting() store.SettingRepository {
+	if s.settingRepository != nil {
+		return s.settingRepository
+	}
+
+	s.settingRepository = sqlrepo.NewSettingRepository(conn{s}, dialect)
+	return s.settingRepository
+}
+
+// txRetryDelay is multiplied by attempt number, so concurrent transactions don't collide again at once
+const txRetryDelay = 10 * time.Millisecond
+
+// isolationLevels maps store levels to database/sql ones
+var isolationLevels = map[store.IsolationLevel]sql.IsolationLevel{
+	store.IsolationDefault:        sql.LevelDefault,
+	store.IsolationReadCommitted:  sql.LevelReadCommitted,
+	store.IsolationRepeatableRead: sql.LevelRepeatableRead,
+	store.IsolationSerializable:   sql.LevelSerializable,
+}
+
+// WithTx begins a transaction and passes to fn a store bound to it.
+// Transaction is committed if fn succeeds and rolled back otherwise.
+// Serialization failures and deadlocks are retried with a new transaction up to opts.MaxRetries times
+func (s *Store) WithTx(ctx context.Context, opts *store.TxOptions, fn func(store.Store) error) error {
+	// nested calls just join the outer transaction
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	if opts == nil {
+		opts = &store.TxOptions{MaxRetries: store.DefaultTxMaxRetries}
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := s.runTx(ctx, opts, fn)
+		if err == nil || !isRetryable(err) || attempt > opts.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * txRetryDelay):
+		}
+	}
+}
+
+// runTx is one attempt of WithTx. Panic in fn rolls the transaction back and goes further
+func (s *Store) runTx(ctx context.Context, opts *store.TxOptions, fn func(store.Store) error) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: isolationLevels[opts.Isolation],
+		ReadOnly:  opts.ReadOnly,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(&Store{db: s.db, tx: tx, queryTimeout: s.queryTimeout}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Ping checks connection to the primary database
+func (s *Store) Ping(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.db.PingContext(ctx)
+}
+
+// querier returns transaction if store is bound to it and plain connection pool otherwise
+func (s *Store) querier() sqlrepo.Querier {
+	if s.tx != nil {
+		return s.tx
+	}
+
+	return s.db
+}
+
+// withTimeout applies query timeout to ctx. Returned function must be called when the query
+// and reading of its results are finished
+func (s *Store) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
@@ -1,21 +1,68 @@
 package sqlstore_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+	"github.com/gopherschool/http-rest-api/internal/app/store/sqlstore"
+	"github.com/gopherschool/http-rest-api/internal/app/store/storetest"
 )
 
 var databaseURL string
 
-// TestMain is called once before all the tests
+// TestMain is called once before all the tests. Without DATABASE_URL tests which need postgres are skipped,
+// e.g. DATABASE_URL="host=localhost dbname=restapi_test user=postgres password=qwe123QWE sslmode=disable" go test ./...
 func TestMain(m *testing.M) {
-	fmt.Println("Starting the tests...")
 	databaseURL = os.Getenv("DATABASE_URL")
 	if databaseURL == "" {
-		databaseURL = "host=localhost dbname=restapi_test user=postgres password=qwe123QWE sslmode=disable"
+		fmt.Println("DATABASE_URL is not set, postgres tests are skipped")
 	}
 
-	// TODO: read the docs for string below
 	os.Exit(m.Run()) // Need to exit with correct code
 }
+
+func TestStore_WithTx(t *testing.T) {
+	t.Parallel()
+
+	db := sqlstore.TestDB(t, databaseURL)
+	ctx := context.Background()
+	s := sqlstore.NewStore(db)
+	errFailed := errors.New("failed")
+
+	err := s.WithTx(ctx, nil, func(tx store.Store) error {
+		assert.NoError(t, tx.User().Create(ctx, models.TestUser(t)))
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+	_, err = s.User().FindByEmail(ctx, "user@example.org")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	assert.Panics(t, func() {
+		s.WithTx(ctx, nil, func(tx store.Store) error {
+			tx.User().Create(ctx, models.TestUser(t))
+			panic("boom")
+		})
+	})
+	_, err = s.User().FindByEmail(ctx, "user@example.org")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	err = s.WithTx(ctx, &store.TxOptions{Isolation: store.IsolationSerializable}, func(tx store.Store) error {
+		return tx.User().Create(ctx, models.TestUser(t))
+	})
+	assert.NoError(t, err)
+	_, err = s.User().FindByEmail(ctx, "user@example.org")
+	assert.NoError(t, err)
+}
+
+func TestStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return sqlstore.NewStore(sqlstore.TestDB(t, databaseURL))
+	})
+}
@@ -1,34 +1,100 @@
 package sqlstore
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
-	"fmt"
+	"encoding/hex"
+	"net/url"
 	"strings"
+	"sync"
 	"testing"
+
+	"github.com/gopherschool/http-rest-api/internal/app/migrate"
+	"github.com/gopherschool/http-rest-api/migrations"
 )
 
-// helper module needed for tests
-// return test store with required configuration
-// and return function which will cleanup the tables
-func TestDB(t *testing.T, databaseURL string) (*sql.DB, func(...string)) {
-	t.Helper() // TODO: read about this method
+// extensionsOnce creates extensions used by migrations in public schema. Extensions are per database,
+// and a copy inside a test schema wouldn't be visible to other tests
+var extensionsOnce sync.Once
+
+// TestDB is a helper for tests. It creates a schema with random name, applies all migrations there
+// and returns connection which uses this schema. The schema is dropped when the test finishes,
+// so tests don't share any data and may run in parallel. Test is skipped if databaseURL is empty
+func TestDB(t *testing.T, databaseURL string) *sql.DB {
+	t.Helper()
+
+	if databaseURL == "" {
+		t.Skip("DATABASE_URL is not set, skipping tests which need postgres")
+	}
 
-	db, err := sql.Open("postgres", databaseURL)
+	admin, err := sql.Open("postgres", databaseURL)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if err := db.Ping(); err != nil {
+	if err := admin.Ping(); err != nil {
+		admin.Close()
 		t.Fatal(err)
 	}
 
-	// returning DB and teardown function which will delete some tables
-	return db, func(tables ...string) {
-		// number of tables can be zero
-		if len(tables) > 0 {
-			db.Exec(fmt.Sprintf("TRUNCATE %s CASCADE", strings.Join(tables, ", ")))
+	extensionsOnce.Do(func() {
+		if _, err = admin.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm SCHEMA public"); err != nil {
+			t.Logf("failed to create extensions: %v", err)
 		}
+	})
+
+	schema := testSchemaName()
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
 
+	db, err := sql.Open("postgres", withSearchPath(databaseURL, schema))
+	if err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
 		db.Close()
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Logf("failed to drop schema %s: %v", schema, err)
+		}
+		admin.Close()
+	})
+
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
 	}
+
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func testSchemaName() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "test_" + hex.EncodeToString(b)
+}
+
+// withSearchPath makes every connection use schema first. lib/pq sends unknown
+// connection parameters to the server, so search_path works for both URL and key=value forms
+func withSearchPath(databaseURL, schema string) string {
+	searchPath := schema + ",public"
+	if strings.HasPrefix(databaseURL, "postgres://") || strings.HasPrefix(databaseURL, "postgresql://") {
+		u, err := url.Parse(databaseURL)
+		if err == nil {
+			q := u.Query()
+			q.Set("search_path", searchPath)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+
+	return databaseURL + " search_path=" + searchPath
 }
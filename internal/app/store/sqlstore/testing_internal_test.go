@@ -0,0 +1,20 @@
+package sqlstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithSearchPath(t *testing.T) {
+	assert.Equal(
+		t,
+		"host=localhost dbname=restapi_test search_path=test_1,public",
+		withSearchPath("host=localhost dbname=restapi_test", "test_1"),
+	)
+	assert.Equal(
+		t,
+		"postgres://localhost/restapi_test?search_path=test_1%2Cpublic&sslmode=disable",
+		withSearchPath("postgres://localhost/restapi_test?sslmode=disable", "test_1"),
+	)
+}
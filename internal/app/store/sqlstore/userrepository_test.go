@@ -1,6 +1,7 @@
 package sqlstore_test
 
 import (
+	"context"
 	"github.com/gopherschool/http-rest-api/internal/app/models"
 	"github.com/gopherschool/http-rest-api/internal/app/store"
 	"github.com/gopherschool/http-rest-api/internal/app/store/sqlstore"
@@ -11,46 +12,175 @@ import (
 
 // tests for Create method
 func TestUserRepository_Create(t *testing.T) {
-	db, teardown := sqlstore.TestDB(t, databaseURL)
-	defer teardown("users") // cleaning users table
+	t.Parallel()
 
+	db := sqlstore.TestDB(t, databaseURL)
+	ctx := context.Background()
 	s := sqlstore.NewStore(db)
 	u := models.TestUser(t)
 	u.ID = rand.Intn(1000)
-	assert.NoError(t, s.User().Create(u)) // check that no error raised
-	assert.NotNil(t, u)                   // check that user is not nil
+	assert.NoError(t, s.User().Create(ctx, u)) // check that no error raised
+	assert.NotNil(t, u)                        // check that user is not nil
+}
+
+func TestUserRepository_CreateDuplicate(t *testing.T) {
+	t.Parallel()
+
+	db := sqlstore.TestDB(t, databaseURL)
+	ctx := context.Background()
+	s := sqlstore.NewStore(db)
+	assert.NoError(t, s.User().Create(ctx, models.TestUser(t)))
+	// same email second time must be rejected by the store
+	assert.ErrorIs(t, s.User().Create(ctx, models.TestUser(t)), store.ErrDuplicate)
 }
 
 func TestUserRepository_FindByEmail(t *testing.T) {
-	db, teardown := sqlstore.TestDB(t, databaseURL)
-	defer teardown("users") // cleaning users table
+	t.Parallel()
 
+	db := sqlstore.TestDB(t, databaseURL)
+	ctx := context.Background()
 	s := sqlstore.NewStore(db)
 	email := "user123@example.org"
-	_, err := s.User().FindByEmail(email)
+	_, err := s.User().FindByEmail(ctx, email)
 	assert.EqualError(t, err, store.ErrRecordNotFound.Error())
 
 	u := models.TestUser(t)
 	u.Email = email
-	s.User().Create(u)
-	u, err = s.User().FindByEmail(email)
+	s.User().Create(ctx, u)
+	u, err = s.User().FindByEmail(ctx, email)
 	assert.NoError(t, err)
 	assert.NotNil(t, u)
 }
 
 func TestUserRepository_FindByID(t *testing.T) {
-	db, teardown := sqlstore.TestDB(t, databaseURL)
-	defer teardown("users")
+	t.Parallel()
 
+	db := sqlstore.TestDB(t, databaseURL)
+	ctx := context.Background()
 	s := sqlstore.NewStore(db)
 	u1 := models.TestUser(t)
-	if err := s.User().Create(u1); err != nil {
+	if err := s.User().Create(ctx, u1); err != nil {
 		t.Fatal(err)
 	}
 	u2 := models.TestUser(t)
 
-	u2, err := s.User().FindByID(u1.ID)
+	u2, err := s.User().FindByID(ctx, u1.ID)
 	assert.NoError(t, err)
 	assert.NotNil(t, u2)
 	assert.Equal(t, u2.ID, u1.ID)
 }
+
+func TestUserRepository_FindByEmailCaseInsensitive(t *testing.T) {
+	t.Parallel()
+
+	db := sqlstore.TestDB(t, databaseURL)
+	ctx := context.Background()
+	s := sqlstore.NewStore(db)
+	u1 := models.TestUser(t)
+	u1.Email = "User@Example.org"
+	assert.NoError(t, s.User().Create(ctx, u1))
+
+	u2, err := s.User().FindByEmail(ctx, "USER@example.ORG")
+	assert.NoError(t, err)
+	assert.Equal(t, u1.ID, u2.ID)
+
+	u3 := models.TestUser(t)
+	u3.Email = "user@EXAMPLE.org"
+	assert.ErrorIs(t, s.User().Create(ctx, u3), store.ErrDuplicate)
+}
+
+func TestUserRepository_List(t *testing.T) {
+	t.Parallel()
+
+	db := sqlstore.TestDB(t, databaseURL)
+	ctx := context.Background()
+	s := sqlstore.NewStore(db)
+	for _, email := range []string{"first@example.org", "second@example.org", "third@example.org"} {
+		u := models.TestUser(t)
+		u.Email = email
+		assert.NoError(t, s.User().Create(ctx, u))
+	}
+
+	users, err := s.User().List(ctx, 2, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, "second@example.org", users[0].Email)
+		assert.Equal(t, "third@example.org", users[1].Email)
+	}
+}
+
+func TestUserRepository_UpdateEncryptedPassword(t *testing.T) {
+	t.Parallel()
+
+	db := sqlstore.TestDB(t, databaseURL)
+	ctx := context.Background()
+	s := sqlstore.NewStore(db)
+	u := models.TestUser(t)
+	assert.NoError(t, s.User().Create(ctx, u))
+
+	assert.NoError(t, u.SetPassword("new_password"))
+	assert.NoError(t, s.User().UpdateEncryptedPassword(ctx, u))
+
+	stored, err := s.User().FindByID(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.True(t, stored.ComparePasswords("new_password"))
+
+	u.ID = -1
+	assert.ErrorIs(t, s.User().UpdateEncryptedPassword(ctx, u), store.ErrRecordNotFound)
+}
+
+func TestUserRepository_Search(t *testing.T) {
+	t.Parallel()
+
+	db := sqlstore.TestDB(t, databaseURL)
+	ctx := context.Background()
+	s := sqlstore.NewStore(db)
+	for _, email := range []string{"john.smith@example.org", "smith@example.org", "other@example.org", "100%_sure@example.org"} {
+		u := models.TestUser(t)
+		u.Email = email
+		assert.NoError(t, s.User().Create(ctx, u))
+	}
+
+	users, err := s.User().Search(ctx, "SMITH", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, users, 2) {
+		// prefix match goes first
+		assert.Equal(t, "smith@example.org", users[0].Email)
+		assert.Equal(t, "john.smith@example.org", users[1].Email)
+	}
+
+	// wildcards are matched literally
+	users, err = s.User().Search(ctx, "%_", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, "100%_sure@example.org", users[0].Email)
+	}
+}
+
+func TestUserRepository_Update(t *testing.T) {
+	t.Parallel()
+
+	db := sqlstore.TestDB(t, databaseURL)
+	ctx := context.Background()
+	s := sqlstore.NewStore(db)
+	u := models.TestUser(t)
+	s.User().Create(ctx, u)
+	other := models.TestUser(t)
+	other.Email = "other@example.org"
+	s.User().Create(ctx, other)
+	stale := *u
+
+	u.Email = "new@example.org"
+	assert.NoError(t, s.User().Update(ctx, u))
+	assert.Equal(t, 2, u.Version)
+
+	// copy loaded before the update can't overwrite it
+	stale.IsAdmin = true
+	assert.ErrorIs(t, s.User().Update(ctx, &stale), store.ErrConflict)
+	assert.ErrorIs(t, s.User().UpdateAvatarURL(ctx, &stale), store.ErrConflict)
+
+	u.Email = other.Email
+	assert.ErrorIs(t, s.User().Update(ctx, u), store.ErrDuplicate)
+
+	assert.ErrorIs(t, s.User().Update(ctx, &models.User{ID: 100}), store.ErrRecordNotFound)
+}
@@ -1,6 +1,19 @@
 package store
 
+import "context"
+
 // Store is an interface for store
 type Store interface {
 	User() UserRepository
+	Organization() OrganizationRepository
+	Membership() MembershipRepository
+	Invitation() InvitationRepository
+	DataExport() DataExportRepository
+	Setting() SettingRepository
+	// WithTx runs fn against a store whose repositories share one transaction.
+	// If fn returns an error or panics, nothing of what it did is saved.
+	// Nested calls join the outer transaction and ignore opts
+	WithTx(ctx context.Context, opts *TxOptions, fn func(Store) error) error
+	// Ping checks that the database behind the store is reachable, used by readiness checks
+	Ping(ctx context.Context) error
 }
@@ -0,0 +1,501 @@
+// Package storetest is a conformance suite for store.Store implementations. Every store runs it
+// from its own tests, so handlers can rely on the same behaviour whichever store they get
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// Run runs the suite against stores returned by newStore. Every subtest gets a new empty store,
+// newStore may skip the test if the store is not available, e.g. without a database
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.Store)
+	}{
+		{"UserCreate", testUserCreate},
+		{"UserUniqueEmail", testUserUniqueEmail},
+		{"UserNotFound", testUserNotFound},
+		{"UserUpdate", testUserUpdate},
+		{"UserList", testUserList},
+		{"UserCopies", testUserCopies},
+		{"UserCertificateSubject", testUserCertificateSubject},
+		{"Organization", testOrganization},
+		{"OrganizationDelete", testOrganizationDelete},
+		{"Membership", testMembership},
+		{"Invitation", testInvitation},
+		{"DataExport", testDataExport},
+		{"Setting", testSetting},
+		{"WithTx", testWithTx},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newStore(t))
+		})
+	}
+}
+
+// createUser saves a valid user with email
+func createUser(t *testing.T, s store.Store, email string) *models.User {
+	t.Helper()
+
+	u := models.TestUser(t)
+	u.Email = email
+	require.NoError(t, s.User().Create(context.Background(), u))
+	return u
+}
+
+func testUserCreate(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u1 := createUser(t, s, "user1@example.org")
+	u2 := createUser(t, s, "user2@example.org")
+	assert.NotZero(t, u1.ID)
+	assert.Greater(t, u2.ID, u1.ID)
+	assert.Equal(t, 1, u1.Version)
+	assert.NotEmpty(t, u1.EncryptedPassword)
+
+	found, err := s.User().FindByID(ctx, u1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "user1@example.org", found.Email)
+	assert.Equal(t, u1.EncryptedPassword, found.EncryptedPassword)
+	assert.Empty(t, found.Password)
+
+	found, err = s.User().FindByEmail(ctx, "USER2@example.org")
+	require.NoError(t, err)
+	assert.Equal(t, u2.ID, found.ID)
+
+	// invalid users are not saved
+	assert.Error(t, s.User().Create(ctx, &models.User{Email: "invalid"}))
+}
+
+func testUserUniqueEmail(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u := createUser(t, s, "user@example.org")
+	createUser(t, s, "other@example.org")
+
+	dup := models.TestUser(t)
+	dup.Email = "User@Example.org"
+	assert.ErrorIs(t, s.User().Create(ctx, dup), store.ErrDuplicate)
+
+	other, err := s.User().FindByEmail(ctx, "other@example.org")
+	require.NoError(t, err)
+	other.Email = u.Email
+	assert.ErrorIs(t, s.User().Update(ctx, other), store.ErrDuplicate)
+
+	// failed update changes nothing
+	found, err := s.User().FindByID(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "other@example.org", found.Email)
+}
+
+func testUserNotFound(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	_, err := s.User().FindByID(ctx, 1)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	_, err = s.User().FindByEmail(ctx, "user@example.org")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	u := models.TestUser(t)
+	u.ID = 1
+	u.Version = 1
+	assert.ErrorIs(t, s.User().Update(ctx, u), store.ErrRecordNotFound)
+	assert.ErrorIs(t, s.User().UpdateAvatarURL(ctx, u), store.ErrRecordNotFound)
+	assert.ErrorIs(t, s.User().UpdateEncryptedPassword(ctx, u), store.ErrRecordNotFound)
+}
+
+func testUserUpdate(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	createUser(t, s, "user@example.org")
+	u, err := s.User().FindByEmail(ctx, "user@example.org")
+	require.NoError(t, err)
+	stale := *u
+
+	u.Email = "new@example.org"
+	u.IsAdmin = true
+	require.NoError(t, s.User().Update(ctx, u))
+	assert.Equal(t, 2, u.Version)
+
+	found, err := s.User().FindByID(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.org", found.Email)
+	assert.True(t, found.IsAdmin)
+	assert.Equal(t, 2, found.Version)
+
+	stale.AvatarURL = "/uploads/avatars/1/256.png"
+	assert.ErrorIs(t, s.User().UpdateAvatarURL(ctx, &stale), store.ErrConflict)
+
+	found.AvatarURL = "/uploads/avatars/1/256.png"
+	require.NoError(t, s.User().UpdateAvatarURL(ctx, found))
+	require.NoError(t, s.User().Anonymize(ctx, found))
+	found, err = s.User().FindByID(ctx, u.ID)
+	require.NoError(t, err)
+	assert.True(t, found.IsErased())
+	assert.Empty(t, found.AvatarURL)
+	assert.Equal(t, 4, found.Version)
+}
+
+func testUserList(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u1 := createUser(t, s, "user1@example.org")
+	u2 := createUser(t, s, "user2@example.org")
+	u3 := createUser(t, s, "user3@example.org")
+
+	users, err := s.User().List(ctx, 2, 0)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, u1.ID, users[0].ID)
+	assert.Equal(t, u2.ID, users[1].ID)
+
+	users, err = s.User().List(ctx, 2, 2)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, u3.ID, users[0].ID)
+
+	// ranking differs between stores, but the exact match always goes first
+	users, err = s.User().Search(ctx, "USER2", 10, 0)
+	require.NoError(t, err)
+	require.NotEmpty(t, users)
+	assert.Equal(t, u2.ID, users[0].ID)
+}
+
+// testUserCopies checks that callers can't change stored data without Update
+func testUserCopies(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u := createUser(t, s, "user@example.org")
+	u.Email = "changed@example.org"
+	u.IsAdmin = true
+
+	found, err := s.User().FindByID(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.org", found.Email)
+	assert.False(t, found.IsAdmin)
+
+	found.AvatarURL = "/uploads/avatars/1/256.png"
+	found, err = s.User().FindByEmail(ctx, "user@example.org")
+	require.NoError(t, err)
+	assert.Empty(t, found.AvatarURL)
+
+	users, err := s.User().List(ctx, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	users[0].Email = "changed@example.org"
+	_, err = s.User().FindByEmail(ctx, "user@example.org")
+	assert.NoError(t, err)
+}
+
+func testUserCertificateSubject(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u := createUser(t, s, "billing@example.org")
+	other := createUser(t, s, "other@example.org")
+
+	_, err := s.User().FindByCertificateSubject(ctx, "dn:CN=billing")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	require.NoError(t, s.User().AddCertificateSubject(ctx, u.ID, "dn:CN=billing"))
+	require.NoError(t, s.User().AddCertificateSubject(ctx, u.ID, "dns:billing.internal"))
+	assert.ErrorIs(t, s.User().AddCertificateSubject(ctx, other.ID, "dn:CN=billing"), store.ErrDuplicate)
+	assert.ErrorIs(t, s.User().AddCertificateSubject(ctx, other.ID+100, "dn:CN=unknown"), store.ErrConflict)
+	assert.ErrorIs(t, s.User().AddCertificateSubject(ctx, other.ID, "CN=other"), models.ErrInvalidCertificateSubject)
+	assert.ErrorIs(t, s.User().AddCertificateSubject(ctx, other.ID, "dns:"), models.ErrInvalidCertificateSubject)
+
+	for _, subject := range []string{"dn:CN=billing", "dns:billing.internal"} {
+		found, err := s.User().FindByCertificateSubject(ctx, subject)
+		require.NoError(t, err)
+		assert.Equal(t, u.ID, found.ID)
+		assert.Equal(t, u.Email, found.Email)
+	}
+
+	// subjects are compared exactly, including their type
+	for _, subject := range []string{"dn:cn=billing", "dns:CN=billing", "CN=billing"} {
+		_, err = s.User().FindByCertificateSubject(ctx, subject)
+		assert.ErrorIs(t, err, store.ErrRecordNotFound, subject)
+	}
+}
+
+func testOrganization(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	_, err := s.Organization().FindByID(ctx, 1)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+	assert.Error(t, s.Organization().Create(ctx, &models.Organization{}))
+
+	o1 := &models.Organization{Name: "Acme"}
+	require.NoError(t, s.Organization().Create(ctx, o1))
+	o2 := &models.Organization{Name: "Globex"}
+	require.NoError(t, s.Organization().Create(ctx, o2))
+	assert.NotZero(t, o1.ID)
+	assert.Greater(t, o2.ID, o1.ID)
+
+	o1.Name = "Changed"
+	found, err := s.Organization().FindByID(ctx, o1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Acme", found.Name)
+}
+
+func testOrganizationDelete(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u := createUser(t, s, "user@example.org")
+	o1 := &models.Organization{Name: "Acme"}
+	require.NoError(t, s.Organization().Create(ctx, o1))
+	o2 := &models.Organization{Name: "Globex"}
+	require.NoError(t, s.Organization().Create(ctx, o2))
+
+	invitations := []*models.Invitation{}
+	for _, o := range []*models.Organization{o1, o2} {
+		require.NoError(t, s.Membership().Create(ctx, &models.Membership{OrganizationID: o.ID, UserID: u.ID, Role: models.RoleOwner}))
+		i := &models.Invitation{
+			OrganizationID: o.ID,
+			Email:          "invited@example.org",
+			Role:           models.RoleMember,
+			InvitedBy:      u.ID,
+			ExpiresAt:      time.Now().Add(time.Hour),
+		}
+		require.NoError(t, s.Invitation().Create(ctx, i))
+		invitations = append(invitations, i)
+	}
+
+	// memberships and invitations go together with organization
+	require.NoError(t, s.Organization().Delete(ctx, o1.ID))
+	_, err := s.Organization().FindByID(ctx, o1.ID)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+	_, err = s.Invitation().FindByID(ctx, invitations[0].ID)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+	members, err := s.Membership().ListByUser(ctx, u.ID)
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	assert.Equal(t, o2.ID, members[0].OrganizationID)
+
+	_, err = s.Invitation().FindByID(ctx, invitations[1].ID)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Organization().Delete(ctx, o1.ID))
+}
+
+func testMembership(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u := createUser(t, s, "user@example.org")
+	o := &models.Organization{Name: "Acme"}
+	require.NoError(t, s.Organization().Create(ctx, o))
+
+	// users and organizations must exist
+	assert.ErrorIs(t, s.Membership().Create(ctx, &models.Membership{
+		OrganizationID: o.ID,
+		UserID:         u.ID + 100,
+		Role:           models.RoleMember,
+	}), store.ErrConflict)
+	assert.ErrorIs(t, s.Membership().Create(ctx, &models.Membership{
+		OrganizationID: o.ID + 100,
+		UserID:         u.ID,
+		Role:           models.RoleMember,
+	}), store.ErrConflict)
+
+	m := &models.Membership{OrganizationID: o.ID, UserID: u.ID, Role: models.RoleOwner}
+	require.NoError(t, s.Membership().Create(ctx, m))
+	assert.ErrorIs(t, s.Membership().Create(ctx, m), store.ErrDuplicate)
+
+	_, err := s.Membership().Find(ctx, o.ID, u.ID+100)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+	assert.ErrorIs(t, s.Membership().UpdateRole(ctx, &models.Membership{
+		OrganizationID: o.ID,
+		UserID:         u.ID + 100,
+		Role:           models.RoleAdmin,
+	}), store.ErrRecordNotFound)
+
+	m.Role = models.RoleAdmin
+	found, err := s.Membership().Find(ctx, o.ID, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleOwner, found.Role)
+	assert.Equal(t, u.Email, found.Email)
+
+	require.NoError(t, s.Membership().UpdateRole(ctx, m))
+	members, err := s.Membership().ListByOrganization(ctx, o.ID)
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	assert.Equal(t, models.RoleAdmin, members[0].Role)
+
+	members, err = s.Membership().ListByUser(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Len(t, members, 1)
+
+	require.NoError(t, s.Membership().DeleteByUser(ctx, u.ID))
+	members, err = s.Membership().ListByUser(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Empty(t, members)
+}
+
+func testInvitation(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u := createUser(t, s, "owner@example.org")
+	o := &models.Organization{Name: "Acme"}
+	require.NoError(t, s.Organization().Create(ctx, o))
+
+	newInvitation := func(email string) *models.Invitation {
+		return &models.Invitation{
+			OrganizationID: o.ID,
+			Email:          email,
+			Role:           models.RoleMember,
+			InvitedBy:      u.ID,
+			ExpiresAt:      time.Now().Add(time.Hour),
+		}
+	}
+
+	_, err := s.Invitation().FindByID(ctx, 1)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	i1 := newInvitation("Invited@Example.org")
+	require.NoError(t, s.Invitation().Create(ctx, i1))
+	assert.Equal(t, "invited@example.org", i1.Email)
+	i2 := newInvitation("other@example.org")
+	require.NoError(t, s.Invitation().Create(ctx, i2))
+
+	invitations, err := s.Invitation().ListByEmail(ctx, "INVITED@example.org")
+	require.NoError(t, err)
+	require.Len(t, invitations, 1)
+	assert.Equal(t, i1.ID, invitations[0].ID)
+
+	require.NoError(t, s.Invitation().MarkAccepted(ctx, i1))
+	assert.NotNil(t, i1.AcceptedAt)
+	assert.ErrorIs(t, s.Invitation().MarkAccepted(ctx, i1), store.ErrConflict)
+	found, err := s.Invitation().FindByID(ctx, i1.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, found.AcceptedAt)
+
+	// IDs of deleted rows are never reused
+	require.NoError(t, s.Invitation().DeleteByEmail(ctx, i1.Email))
+	_, err = s.Invitation().FindByID(ctx, i1.ID)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+	i3 := newInvitation("third@example.org")
+	require.NoError(t, s.Invitation().Create(ctx, i3))
+	assert.Greater(t, i3.ID, i2.ID)
+	found, err = s.Invitation().FindByID(ctx, i2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "other@example.org", found.Email)
+}
+
+func testDataExport(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u := createUser(t, s, "user@example.org")
+
+	assert.ErrorIs(t, s.DataExport().Create(ctx, &models.DataExport{
+		UserID: u.ID + 100,
+		Status: models.DataExportPending,
+	}), store.ErrConflict)
+	assert.ErrorIs(t, s.DataExport().Update(ctx, &models.DataExport{ID: 1}), store.ErrRecordNotFound)
+
+	e1 := &models.DataExport{UserID: u.ID, Status: models.DataExportPending}
+	require.NoError(t, s.DataExport().Create(ctx, e1))
+	assert.NotZero(t, e1.ID)
+	assert.False(t, e1.CreatedAt.IsZero())
+
+	// changes are saved only by Update
+	e1.Status = models.DataExportCompleted
+	found, err := s.DataExport().FindByID(ctx, e1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.DataExportPending, found.Status)
+
+	now := time.Now()
+	e1.BlobKey = "exports/1.zip"
+	e1.CompletedAt = &now
+	require.NoError(t, s.DataExport().Update(ctx, e1))
+	found, err = s.DataExport().FindByID(ctx, e1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.DataExportCompleted, found.Status)
+	assert.Equal(t, "exports/1.zip", found.BlobKey)
+	assert.NotNil(t, found.CompletedAt)
+
+	exports, err := s.DataExport().ListByUser(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Len(t, exports, 1)
+
+	require.NoError(t, s.DataExport().DeleteByUser(ctx, u.ID))
+	_, err = s.DataExport().FindByID(ctx, e1.ID)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	e2 := &models.DataExport{UserID: u.ID, Status: models.DataExportPending}
+	require.NoError(t, s.DataExport().Create(ctx, e2))
+	assert.Greater(t, e2.ID, e1.ID)
+}
+
+func testSetting(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	_, err := s.Setting().Find(ctx, "email_provider_rules")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	require.NoError(t, s.Setting().Create(ctx, "email_provider_rules", "true"))
+	assert.ErrorIs(t, s.Setting().Create(ctx, "email_provider_rules", "false"), store.ErrDuplicate)
+
+	value, err := s.Setting().Find(ctx, "email_provider_rules")
+	require.NoError(t, err)
+	assert.Equal(t, "true", value)
+}
+
+func testWithTx(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	errFailed := errors.New("failed")
+
+	err := s.WithTx(ctx, nil, func(tx store.Store) error {
+		u := models.TestUser(t)
+		require.NoError(t, tx.User().Create(ctx, u))
+
+		// the transaction sees its own writes, also in nested calls
+		_, err := tx.User().FindByID(ctx, u.ID)
+		assert.NoError(t, err)
+		return tx.WithTx(ctx, nil, func(nested store.Store) error {
+			_, err := nested.User().FindByEmail(ctx, u.Email)
+			assert.NoError(t, err)
+			return errFailed
+		})
+	})
+	assert.ErrorIs(t, err, errFailed)
+	_, err = s.User().FindByEmail(ctx, "user@example.org")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	assert.Panics(t, func() {
+		s.WithTx(ctx, nil, func(tx store.Store) error {
+			tx.User().Create(ctx, models.TestUser(t))
+			panic("boom")
+		})
+	})
+	_, err = s.User().FindByEmail(ctx, "user@example.org")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	// rolled back changes of existing rows are undone too
+	u := createUser(t, s, "user@example.org")
+	err = s.WithTx(ctx, nil, func(tx store.Store) error {
+		u.Email = "changed@example.org"
+		require.NoError(t, tx.User().Update(ctx, u))
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+	found, err := s.User().FindByID(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.org", found.Email)
+	assert.Equal(t, 1, found.Version)
+
+	err = s.WithTx(ctx, &store.TxOptions{Isolation: store.IsolationSerializable}, func(tx store.Store) error {
+		o := &models.Organization{Name: "Acme"}
+		if err := tx.Organization().Create(ctx, o); err != nil {
+			return err
+		}
+
+		return tx.Membership().Create(ctx, &models.Membership{
+			OrganizationID: o.ID,
+			UserID:         found.ID,
+			Role:           models.RoleOwner,
+		})
+	})
+	require.NoError(t, err)
+	members, err := s.Membership().ListByUser(ctx, found.ID)
+	require.NoError(t, err)
+	assert.Len(t, members, 1)
+}
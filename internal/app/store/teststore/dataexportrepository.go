@@ -0,0 +1,137 @@
+package teststore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// DataExportRepository structure for tests
+type DataExportRepository struct {
+	store *Store
+	*dataExportTable
+}
+
+// dataExportTable is shared by repositories of the store and its transactions.
+// Stored exports are never changed in place, updates replace them
+type dataExportTable struct {
+	mu      sync.RWMutex
+	exports map[int]*models.DataExport
+	lastID  int
+}
+
+// Create test export in `exports` map
+func (r *DataExportRepository) Create(ctx context.Context, e *models.DataExport) error {
+	if _, err := r.store.User().FindByID(ctx, e.UserID); err != nil {
+		return store.ErrConflict
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	e.ID = r.lastID
+	e.CreatedAt = time.Now()
+	stored := *e
+	r.exports[e.ID] = &stored
+	r.store.onRollback(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.exports[stored.ID] == &stored {
+			delete(r.exports, stored.ID)
+		}
+	})
+
+	return nil
+}
+
+// FindByID in `exports` map
+func (r *DataExportRepository) FindByID(ctx context.Context, id int) (*models.DataExport, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.exports[id]
+	if !ok {
+		return nil, store.ErrRecordNotFound
+	}
+
+	c := *e
+	return &c, nil
+}
+
+// Update in `exports` map
+func (r *DataExportRepository) Update(ctx context.Context, e *models.DataExport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.exports[e.ID]
+	if !ok {
+		return store.ErrRecordNotFound
+	}
+
+	updated := *stored
+	updated.Status = e.Status
+	updated.BlobKey = e.BlobKey
+	updated.Error = e.Error
+	updated.CompletedAt = e.CompletedAt
+	r.exports[e.ID] = &updated
+	r.store.onRollback(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.exports[stored.ID] == &updated {
+			r.exports[stored.ID] = stored
+		}
+	})
+
+	return nil
+}
+
+// ListByUser in `exports` map sorted by ID like in sqlstore
+func (r *DataExportRepository) ListByUser(ctx context.Context, userID int) ([]*models.DataExport, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	exports := []*models.DataExport{}
+	for _, e := range r.exports {
+		if e.UserID == userID {
+			c := *e
+			exports = append(exports, &c)
+		}
+	}
+
+	sort.Slice(exports, func(i, j int) bool { return exports[i].ID < exports[j].ID })
+	return exports, nil
+}
+
+// DeleteByUser in `exports` map
+func (r *DataExportRepository) DeleteByUser(ctx context.Context, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := []*models.DataExport{}
+	for id, e := range r.exports {
+		if e.UserID == userID {
+			deleted = append(deleted, e)
+			delete(r.exports, id)
+		}
+	}
+
+	r.store.onRollback(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		for _, e := range deleted {
+			if _, ok := r.exports[e.ID]; !ok {
+				r.exports[e.ID] = e
+			}
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package teststore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// InvitationRepository structure for tests
+type InvitationRepository struct {
+	store *Store
+	*invitationTable
+}
+
+// invitationTable is shared by repositories of the store and its transactions.
+// Stored invitations are never changed in place, updates replace them
+type invitationTable struct {
+	mu          sync.RWMutex
+	invitations map[int]*models.Invitation
+	lastID      int
+}
+
+// Create test invitation in `invitations` map. Emulates foreign key on organizations
+func (r *InvitationRepository) Create(ctx context.Context, i *models.Invitation) error {
+	if err := i.Validate(); err != nil {
+		return err
+	}
+
+	if err := i.BeforeCreate(); err != nil {
+		return err
+	}
+
+	if _, err := r.store.Organization().FindByID(ctx, i.OrganizationID); err != nil {
+		return store.ErrConflict
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	i.ID = r.lastID
+	stored := *i
+	r.invitations[i.ID] = &stored
+	r.store.onRollback(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.invitations[stored.ID] == &stored {
+			delete(r.invitations, stored.ID)
+		}
+	})
+
+	return nil
+}
+
+// FindByID in `invitations` map
+func (r *InvitationRepository) FindByID(ctx context.Context, id int) (*models.Invitation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i, ok := r.invitations[id]
+	if !ok {
+		return nil, store.ErrRecordNotFound
+	}
+
+	c := *i
+	return &c, nil
+}
+
+// MarkAccepted in `invitations` map
+func (r *InvitationRepository) MarkAccepted(ctx context.Context, i *models.Invitation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.invitations[i.ID]
+	if !ok || stored.AcceptedAt != nil {
+		return store.ErrConflict
+	}
+
+	now := time.Now()
+	updated := *stored
+	updated.AcceptedAt = &now
+	r.invitations[i.ID] = &updated
+	i.AcceptedAt = &now
+	r.store.onRollback(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.invitations[stored.ID] == &updated {
+			r.invitations[stored.ID] = stored
+		}
+	})
+
+	return nil
+}
+
+// ListByEmail in `invitations` map sorted by ID like in sqlstore
+func (r *InvitationRepository) ListByEmail(ctx context.Context, email string) ([]*models.Invitation, error) {
+	email = models.NormalizeEmail(email)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	invitations := []*models.Invitation{}
+	for _, i := range r.invitations {
+		if i.Email == email {
+			c := *i
+			invitations = append(invitations, &c)
+		}
+	}
+
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].ID < invitations[j].ID })
+	return invitations, nil
+}
+
+// DeleteByEmail in `invitations` map
+func (r *InvitationRepository) DeleteByEmail(ctx context.Context, email string) error {
+	email = models.NormalizeEmail(email)
+	r.deleteWhere(func(i *models.Invitation) bool { return i.Email == email })
+	return nil
+}
+
+// deleteByOrganization is called by OrganizationRepository.Delete
+func (r *InvitationRepository) deleteByOrganization(organizationID int) {
+	r.deleteWhere(func(i *models.Invitation) bool { return i.OrganizationID == organizationID })
+}
+
+// deleteWhere deletes invitations which match
+func (r *InvitationRepository) deleteWhere(match func(*models.Invitation) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := []*models.Invitation{}
+	for id, i := range r.invitations {
+		if match(i) {
+			deleted = append(deleted, i)
+			delete(r.invitations, id)
+		}
+	}
+
+	r.store.onRollback(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		for _, i := range deleted {
+			if _, ok := r.invitations[i.ID]; !ok {
+				r.invitations[i.ID] = i
+			}
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package teststore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
+)
+
+func TestInvitationRepository(t *testing.T) {
+	ctx := context.Background()
+	s := teststore.NewStore()
+	u := models.TestUser(t)
+	s.User().Create(ctx, u)
+	o := &models.Organization{Name: "Acme"}
+	s.Organization().Create(ctx, o)
+
+	inv := &models.Invitation{
+		OrganizationID: o.ID,
+		Email:          "Friend@Example.org",
+		Role:           models.RoleMember,
+		InvitedBy:      u.ID,
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}
+	assert.NoError(t, s.Invitation().Create(ctx, inv))
+	assert.Equal(t, "friend@example.org", inv.Email)
+
+	found, err := s.Invitation().FindByID(ctx, inv.ID)
+	assert.NoError(t, err)
+	assert.True(t, found.IsActive(time.Now()))
+
+	assert.NoError(t, s.Invitation().MarkAccepted(ctx, inv))
+	assert.ErrorIs(t, s.Invitation().MarkAccepted(ctx, inv), store.ErrConflict)
+
+	found, err = s.Invitation().FindByID(ctx, inv.ID)
+	assert.NoError(t, err)
+	assert.False(t, found.IsActive(time.Now()))
+
+	_, err = s.Invitation().FindByID(ctx, inv.ID+1)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+}
@@ -0,0 +1,191 @@
+package teststore
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// membershipKey is a composite key like primary key of memberships table in sqlstore
+type membershipKey struct {
+	organizationID int
+	userID         int
+}
+
+// MembershipRepository structure for tests
+type MembershipRepository struct {
+	store *Store
+	*membershipTable
+}
+
+// membershipTable is shared by repositories of the store and its transactions.
+// Stored memberships are never changed in place, updates replace them
+type membershipTable struct {
+	mu          sync.RWMutex
+	memberships map[membershipKey]*models.Membership
+}
+
+// Create test membership in `memberships` map. Emulates foreign keys from sqlstore
+func (r *MembershipRepository) Create(ctx context.Context, m *models.Membership) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := r.store.Organization().FindByID(ctx, m.OrganizationID); err != nil {
+		return store.ErrConflict
+	}
+
+	if _, err := r.store.User().FindByID(ctx, m.UserID); err != nil {
+		return store.ErrConflict
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := membershipKey{organizationID: m.OrganizationID, userID: m.UserID}
+	if _, ok := r.memberships[key]; ok {
+		return store.ErrDuplicate
+	}
+
+	stored := &models.Membership{
+		OrganizationID: m.OrganizationID,
+		UserID:         m.UserID,
+		Role:           m.Role,
+	}
+	r.memberships[key] = stored
+	r.store.onRollback(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.memberships[key] == stored {
+			delete(r.memberships, key)
+		}
+	})
+
+	return nil
+}
+
+// Find in `memberships` map
+func (r *MembershipRepository) Find(ctx context.Context, organizationID, userID int) (*models.Membership, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m, ok := r.memberships[membershipKey{organizationID: organizationID, userID: userID}]
+	if !ok {
+		return nil, store.ErrRecordNotFound
+	}
+
+	return r.withEmail(ctx, m), nil
+}
+
+// ListByOrganization in `memberships` map sorted by user ID like in sqlstore
+func (r *MembershipRepository) ListByOrganization(ctx context.Context, organizationID int) ([]*models.Membership, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	members := []*models.Membership{}
+	for key, m := range r.memberships {
+		if key.organizationID == organizationID {
+			members = append(members, r.withEmail(ctx, m))
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool { return members[i].UserID < members[j].UserID })
+	return members, nil
+}
+
+// ListByUser in `memberships` map sorted by organization ID like in sqlstore
+func (r *MembershipRepository) ListByUser(ctx context.Context, userID int) ([]*models.Membership, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	members := []*models.Membership{}
+	for key, m := range r.memberships {
+		if key.userID == userID {
+			members = append(members, r.withEmail(ctx, m))
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool { return members[i].OrganizationID < members[j].OrganizationID })
+	return members, nil
+}
+
+// DeleteByUser in `memberships` map
+func (r *MembershipRepository) DeleteByUser(ctx context.Context, userID int) error {
+	r.deleteWhere(func(key membershipKey) bool { return key.userID == userID })
+	return nil
+}
+
+// deleteByOrganization is called by OrganizationRepository.Delete
+func (r *MembershipRepository) deleteByOrganization(organizationID int) {
+	r.deleteWhere(func(key membershipKey) bool { return key.organizationID == organizationID })
+}
+
+// deleteWhere deletes memberships whose keys match
+func (r *MembershipRepository) deleteWhere(match func(membershipKey) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := []*models.Membership{}
+	for key, m := range r.memberships {
+		if match(key) {
+			deleted = append(deleted, m)
+			delete(r.memberships, key)
+		}
+	}
+
+	r.store.onRollback(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		for _, m := range deleted {
+			key := membershipKey{organizationID: m.OrganizationID, userID: m.UserID}
+			if _, ok := r.memberships[key]; !ok {
+				r.memberships[key] = m
+			}
+		}
+	})
+}
+
+// UpdateRole in `memberships` map
+func (r *MembershipRepository) UpdateRole(ctx context.Context, m *models.Membership) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := membershipKey{organizationID: m.OrganizationID, userID: m.UserID}
+	stored, ok := r.memberships[key]
+	if !ok {
+		return store.ErrRecordNotFound
+	}
+
+	updated := *stored
+	updated.Role = m.Role
+	r.memberships[key] = &updated
+	r.store.onRollback(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.memberships[key] == &updated {
+			r.memberships[key] = stored
+		}
+	})
+
+	return nil
+}
+
+// withEmail returns copy of membership with user's email like JOIN in sqlstore does
+func (r *MembershipRepository) withEmail(ctx context.Context, m *models.Membership) *models.Membership {
+	res := *m
+	if u, err := r.store.User().FindByID(ctx, m.UserID); err == nil {
+		res.Email = u.Email
+	}
+
+	return &res
+}
@@ -0,0 +1,84 @@
+package teststore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// OrganizationRepository structure for tests
+type OrganizationRepository struct {
+	store *Store
+	*organizationTable
+}
+
+// organizationTable is shared by repositories of the store and its transactions
+type organizationTable struct {
+	mu            sync.RWMutex
+	organizations map[int]*models.Organization
+	lastID        int
+}
+
+// Create test organization in `organizations` map
+func (r *OrganizationRepository) Create(ctx context.Context, o *models.Organization) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	o.ID = r.lastID
+	stored := *o
+	r.organizations[o.ID] = &stored
+	r.store.onRollback(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.organizations[stored.ID] == &stored {
+			delete(r.organizations, stored.ID)
+		}
+	})
+
+	return nil
+}
+
+// FindByID in `organizations` map
+func (r *OrganizationRepository) FindByID(ctx context.Context, id int) (*models.Organization, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	o, ok := r.organizations[id]
+	if !ok {
+		return nil, store.ErrRecordNotFound
+	}
+
+	c := *o
+	return &c, nil
+}
+
+// Delete in `organizations` map. Emulates cascade of foreign keys of memberships and invitations
+func (r *OrganizationRepository) Delete(ctx context.Context, id int) error {
+	r.mu.Lock()
+	o, ok := r.organizations[id]
+	delete(r.organizations, id)
+	r.mu.Unlock()
+
+	if ok {
+		r.store.onRollback(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			if _, ok := r.organizations[id]; !ok {
+				r.organizations[id] = o
+			}
+		})
+	}
+
+	r.store.membershipRepository.deleteByOrganization(id)
+	r.store.invitationRepository.deleteByOrganization(id)
+	return nil
+}
@@ -0,0 +1,65 @@
+package teststore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
+)
+
+func TestOrganizationRepository_Create(t *testing.T) {
+	ctx := context.Background()
+	s := teststore.NewStore()
+	o := &models.Organization{Name: "Acme"}
+	assert.NoError(t, s.Organization().Create(ctx, o))
+	assert.NotZero(t, o.ID)
+
+	assert.Error(t, s.Organization().Create(ctx, &models.Organization{}))
+}
+
+func TestOrganizationRepository_FindByID(t *testing.T) {
+	ctx := context.Background()
+	s := teststore.NewStore()
+	_, err := s.Organization().FindByID(ctx, 1)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	o := &models.Organization{Name: "Acme"}
+	s.Organization().Create(ctx, o)
+	found, err := s.Organization().FindByID(ctx, o.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Acme", found.Name)
+}
+
+func TestMembershipRepository(t *testing.T) {
+	ctx := context.Background()
+	s := teststore.NewStore()
+	u := models.TestUser(t)
+	s.User().Create(ctx, u)
+	o := &models.Organization{Name: "Acme"}
+	s.Organization().Create(ctx, o)
+
+	m := &models.Membership{OrganizationID: o.ID, UserID: u.ID, Role: models.RoleMember}
+	assert.NoError(t, s.Membership().Create(ctx, m))
+	assert.ErrorIs(t, s.Membership().Create(ctx, m), store.ErrDuplicate)
+	assert.ErrorIs(t, s.Membership().Create(ctx, &models.Membership{OrganizationID: o.ID + 1, UserID: u.ID, Role: models.RoleMember}), store.ErrConflict)
+	assert.Error(t, s.Membership().Create(ctx, &models.Membership{OrganizationID: o.ID, UserID: u.ID, Role: "unknown"}))
+
+	found, err := s.Membership().Find(ctx, o.ID, u.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, u.Email, found.Email)
+
+	m.Role = models.RoleAdmin
+	assert.NoError(t, s.Membership().UpdateRole(ctx, m))
+	members, err := s.Membership().ListByOrganization(ctx, o.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, members, 1) {
+		assert.Equal(t, models.RoleAdmin, members[0].Role)
+	}
+
+	_, err = s.Membership().Find(ctx, o.ID, u.ID+1)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+}
@@ -0,0 +1,53 @@
+package teststore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// SettingRepository structure for tests
+type SettingRepository struct {
+	store *Store
+	*settingTable
+}
+
+// settingTable is shared by repositories of the store and its transactions
+type settingTable struct {
+	mu       sync.RWMutex
+	settings map[string]string
+}
+
+// Create test setting in `settings` map, emulates primary key on name
+func (r *SettingRepository) Create(ctx context.Context, name, value string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.settings[name]; ok {
+		return store.ErrDuplicate
+	}
+
+	r.settings[name] = value
+	r.store.onRollback(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		delete(r.settings, name)
+	})
+
+	return nil
+}
+
+// Find in `settings` map
+func (r *SettingRepository) Find(ctx context.Context, name string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	value, ok := r.settings[name]
+	if !ok {
+		return "", store.ErrRecordNotFound
+	}
+
+	return value, nil
+}
@@ -1,32 +1,144 @@
+// Package teststore keeps all data in memory. It's used by tests of handlers and as "memory" backend
+// of the server for development without a database. Everything is lost when the process exits
 package teststore
 
 import (
+	"context"
+	"sync"
+
 	"github.com/gopherschool/http-rest-api/internal/app/models"
 	"github.com/gopherschool/http-rest-api/internal/app/store"
 )
 
-// another realization of store for tests (?)
-
+// Store is safe for concurrent use: every table guards its data with its own mutex,
+// and transactions are run one at a time
 type Store struct {
-	userRepository *UserRepository
+	tables                 *tables
+	txMu                   *sync.Mutex // shared with stores passed to WithTx callbacks
+	undo                   *[]func()   // not nil for stores passed to WithTx callbacks, see onRollback
+	userRepository         *UserRepository
+	organizationRepository *OrganizationRepository
+	membershipRepository   *MembershipRepository
+	invitationRepository   *InvitationRepository
+	dataExportRepository   *DataExportRepository
+	settingRepository      *SettingRepository
+}
+
+// tables keep the data. They are shared by the store and stores of its transactions,
+// which differ only in repositories bound to them
+type tables struct {
+	users         *userTable
+	organizations *organizationTable
+	memberships   *membershipTable
+	invitations   *invitationTable
+	exports       *dataExportTable
+	settings      *settingTable
 }
 
-// NewStore returns pointer on store
+// NewStore returns pointer on store. Repositories are created at once, so concurrent
+// calls of User() and others don't race
 func NewStore() *Store {
-	return &Store{}
+	return newStore(&tables{
+		users: &userTable{
+			users:   make(map[int]*models.User),
+			byEmail: make(map[string]int),
+			certs:   make(map[string]int),
+		},
+		organizations: &organizationTable{organizations: make(map[int]*models.Organization)},
+		memberships:   &membershipTable{memberships: make(map[membershipKey]*models.Membership)},
+		invitations:   &invitationTable{invitations: make(map[int]*models.Invitation)},
+		exports:       &dataExportTable{exports: make(map[int]*models.DataExport)},
+		settings:      &settingTable{settings: make(map[string]string)},
+	}, &sync.Mutex{}, nil)
+}
+
+// newStore returns store with repositories working with t
+func newStore(t *tables, txMu *sync.Mutex, undo *[]func()) *Store {
+	s := &Store{tables: t, txMu: txMu, undo: undo}
+	s.userRepository = &UserRepository{store: s, userTable: t.users}
+	s.organizationRepository = &OrganizationRepository{store: s, organizationTable: t.organizations}
+	s.membershipRepository = &MembershipRepository{store: s, membershipTable: t.memberships}
+	s.invitationRepository = &InvitationRepository{store: s, invitationTable: t.invitations}
+	s.dataExportRepository = &DataExportRepository{store: s, dataExportTable: t.exports}
+	s.settingRepository = &SettingRepository{store: s, settingTable: t.settings}
+	return s
 }
 
 // User is special method to avoid using repositories without the store.
 // Example of such call: store.User().Create()
 func (s *Store) User() store.UserRepository {
-	if s.userRepository != nil {
-		return s.userRepository
+	return s.userRepository
+}
+
+// Organization returns repository of organizations, see User
+func (s *Store) Organization() store.OrganizationRepository {
+	return s.organizationRepository
+}
+
+// Membership returns repository which links users and organizations
+func (s *Store) Membership() store.MembershipRepository {
+	return s.membershipRepository
+}
+
+// Invitation returns repository of invitations to organizations
+func (s *Store) Invitation() store.InvitationRepository {
+	return s.invitationRepository
+}
+
+// DataExport returns repository of personal data exports
+func (s *Store) DataExport() store.DataExportRepository {
+	return s.dataExportRepository
+}
+
+// Setting returns repository of settings
+func (s *Store) Setting() store.SettingRepository {
+	return s.settingRepository
+}
+
+// WithTx passes to fn a store whose repositories log how to undo every write they make.
+// If fn fails or panics, the log is replayed backwards, so only the writes of fn are reverted
+// and writes made outside of the transaction meanwhile are kept. Transactions don't run in parallel,
+// but there is no isolation from writes outside of them: fn sees them. opts are ignored
+func (s *Store) WithTx(ctx context.Context, opts *store.TxOptions, fn func(store.Store) error) error {
+	if s.undo != nil {
+		return fn(s)
 	}
 
-	s.userRepository = &UserRepository{
-		store: s,
-		users: make(map[int]*models.User),
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	var undo []func()
+	rollback := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
 	}
 
-	return s.userRepository
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(newStore(s.tables, s.txMu, &undo)); err != nil {
+		rollback()
+		return err
+	}
+
+	return nil
+}
+
+// Ping always succeeds, there is nothing to connect to
+func (s *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+// onRollback registers fn which reverts a write made in the transaction, outside of transactions
+// writes are final. fn takes locks it needs itself, and it must revert the write only if the record
+// is still the one the transaction wrote: newer writes made outside of the transaction win
+func (s *Store) onRollback(fn func()) {
+	if s.undo != nil {
+		*s.undo = append(*s.undo, fn)
+	}
 }
@@ -0,0 +1,135 @@
+package teststore_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+	"github.com/gopherschool/http-rest-api/internal/app/store/storetest"
+	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
+)
+
+func TestStore_WithTx(t *testing.T) {
+	ctx := context.Background()
+	s := teststore.NewStore()
+	errFailed := errors.New("failed")
+
+	err := s.WithTx(ctx, nil, func(tx store.Store) error {
+		assert.NoError(t, tx.User().Create(ctx, models.TestUser(t)))
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+	_, err = s.User().FindByEmail(ctx, "user@example.org")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	assert.Panics(t, func() {
+		s.WithTx(ctx, nil, func(tx store.Store) error {
+			tx.User().Create(ctx, models.TestUser(t))
+			panic("boom")
+		})
+	})
+	_, err = s.User().FindByEmail(ctx, "user@example.org")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	err = s.WithTx(ctx, nil, func(tx store.Store) error {
+		// nested transaction joins the outer one
+		return tx.WithTx(ctx, nil, func(tx store.Store) error {
+			return tx.User().Create(ctx, models.TestUser(t))
+		})
+	})
+	assert.NoError(t, err)
+	_, err = s.User().FindByEmail(ctx, "user@example.org")
+	assert.NoError(t, err)
+}
+
+func TestStore_WithTx_KeepsWritesOutside(t *testing.T) {
+	ctx := context.Background()
+	s := teststore.NewStore()
+	errFailed := errors.New("failed")
+	u := models.TestUser(t)
+	assert.NoError(t, s.User().Create(ctx, u))
+	o := &models.Organization{Name: "Acme"}
+	assert.NoError(t, s.Organization().Create(ctx, o))
+	assert.NoError(t, s.Membership().Create(ctx, &models.Membership{OrganizationID: o.ID, UserID: u.ID, Role: models.RoleOwner}))
+
+	other := models.TestUser(t)
+	other.Email = "other@example.org"
+	err := s.WithTx(ctx, nil, func(tx store.Store) error {
+		inTx := models.TestUser(t)
+		inTx.Email = "tx@example.org"
+		assert.NoError(t, tx.User().Create(ctx, inTx))
+		assert.NoError(t, tx.Membership().UpdateRole(ctx, &models.Membership{OrganizationID: o.ID, UserID: u.ID, Role: models.RoleMember}))
+		found, err := tx.User().FindByID(ctx, u.ID)
+		assert.NoError(t, err)
+		found.Email = "changed@example.org"
+		assert.NoError(t, tx.User().Update(ctx, found))
+
+		// e.g. signup of another user by a concurrent request
+		assert.NoError(t, s.User().Create(ctx, other))
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+
+	_, err = s.User().FindByEmail(ctx, "other@example.org")
+	assert.NoError(t, err)
+	_, err = s.User().FindByEmail(ctx, "tx@example.org")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+	found, err := s.User().FindByEmail(ctx, "user@example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, u.Version, found.Version)
+	m, err := s.Membership().Find(ctx, o.ID, u.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleOwner, m.Role)
+}
+
+func TestStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return teststore.NewStore()
+	})
+}
+
+func TestStore_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	s := teststore.NewStore()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			u := models.TestUser(t)
+			u.Email = fmt.Sprintf("user%d@example.org", i)
+			err := s.WithTx(ctx, nil, func(tx store.Store) error {
+				return tx.User().Create(ctx, u)
+			})
+			assert.NoError(t, err)
+
+			// everybody tries to take the same email, only one wins
+			found, err := s.User().FindByID(ctx, u.ID)
+			if assert.NoError(t, err) {
+				found.Email = "taken@example.org"
+				s.User().Update(ctx, found)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	users, err := s.User().List(ctx, 100, 0)
+	assert.NoError(t, err)
+	assert.Len(t, users, 20)
+
+	taken := 0
+	for _, u := range users {
+		if u.Email == "taken@example.org" {
+			taken++
+		}
+	}
+	assert.Equal(t, 1, taken)
+}
@@ -1,18 +1,35 @@
 package teststore
 
 import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/gopherschool/http-rest-api/internal/app/models"
 	"github.com/gopherschool/http-rest-api/internal/app/store"
 )
 
-// UserRepository structure for tests
+// UserRepository keeps users in memory. Stored users are never handed out,
+// callers get copies and change stored data only through repository methods
 type UserRepository struct {
 	store *Store
-	users map[int]*models.User
+	*userTable
+}
+
+// userTable is shared by repositories of the store and its transactions. Stored users
+// are never changed in place, updates replace them, see update
+type userTable struct {
+	mu      sync.RWMutex
+	users   map[int]*models.User
+	byEmail map[string]int // normalized email -> ID, emulates unique index on email from sqlstore
+	certs   map[string]int // certificate subject -> ID, emulates user_certificates table
+	lastID  int            // IDs are never reused, like sequences in sqlstore
 }
 
 // Create test user in `users` map
-func (r *UserRepository) Create(u *models.User) error {
+func (r *UserRepository) Create(ctx context.Context, u *models.User) error {
 	// check if user is valid. if OK - run BeforeCreate callback
 	if err := u.Validate(); err != nil {
 		return err
@@ -22,29 +39,255 @@ func (r *UserRepository) Create(u *models.User) error {
 		return err
 	}
 
-	u.ID = len(r.users) + 1
-	r.users[u.ID] = u
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	email := models.NormalizeEmail(u.Email)
+	if _, ok := r.byEmail[email]; ok {
+		return store.ErrDuplicate
+	}
+
+	r.lastID++
+	u.ID = r.lastID
+	u.Version = 1
+	stored := *u
+	stored.Password = "" // only the hash is saved, like in sqlstore
+	r.users[u.ID] = &stored
+	r.byEmail[email] = u.ID
+	r.store.onRollback(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if current, ok := r.users[stored.ID]; ok {
+			delete(r.byEmail, models.NormalizeEmail(current.Email))
+			delete(r.users, stored.ID)
+		}
+	})
 
 	return nil
 }
 
-// FindByEmail in `users` map
-func (r *UserRepository) FindByEmail(email string) (*models.User, error) {
-	for _, u := range r.users {
-		if u.Email == email {
-			return u, nil
-		}
+// FindByEmail in `users` map, emails are compared in normalized form like in sqlstore
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, ok := r.byEmail[models.NormalizeEmail(email)]
+	if !ok {
+		return nil, store.ErrRecordNotFound
 	}
-	return nil, store.ErrRecordNotFound
+
+	c := *r.users[id]
+	return &c, nil
 }
 
-// TODO: implement till the end
 // FindByID in `users` map
-func (r *UserRepository) FindByID(ID int) (*models.User, error) {
+func (r *UserRepository) FindByID(ctx context.Context, ID int) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	u, ok := r.users[ID]
 	if !ok {
 		return nil, store.ErrRecordNotFound
 	}
 
-	return u, nil
+	c := *u
+	return &c, nil
+}
+
+// Update in `users` map, emulates unique index on email
+func (r *UserRepository) Update(ctx context.Context, u *models.User) error {
+	return r.update(u, func(stored *models.User) {
+		stored.Email = u.Email
+		stored.EncryptedPassword = u.EncryptedPassword
+		stored.IsAdmin = u.IsAdmin
+	})
+}
+
+// UpdateEncryptedPassword in `users` map
+func (r *UserRepository) UpdateEncryptedPassword(ctx context.Context, u *models.User) error {
+	return r.update(u, func(stored *models.User) {
+		stored.EncryptedPassword = u.EncryptedPassword
+	})
+}
+
+// UpdateAvatarURL in `users` map
+func (r *UserRepository) UpdateAvatarURL(ctx context.Context, u *models.User) error {
+	return r.update(u, func(stored *models.User) {
+		stored.AvatarURL = u.AvatarURL
+	})
+}
+
+// Anonymize in `users` map
+func (r *UserRepository) Anonymize(ctx context.Context, u *models.User) error {
+	if _, err := r.FindByID(ctx, u.ID); err != nil {
+		return err
+	}
+
+	u.Anonymize(time.Now())
+	return r.update(u, func(stored *models.User) {
+		version := stored.Version
+		*stored = *u
+		stored.Version = version
+	})
+}
+
+// AddCertificateSubject in `certs` map, emulates primary key on subject and foreign key on user
+func (r *UserRepository) AddCertificateSubject(ctx context.Context, userID int, subject string) error {
+	if err := models.ValidateCertificateSubject(subject); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.certs[subject]; ok {
+		return store.ErrDuplicate
+	}
+
+	if _, ok := r.users[userID]; !ok {
+		return store.ErrConflict
+	}
+
+	r.certs[subject] = userID
+	r.store.onRollback(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.certs[subject] == userID {
+			delete(r.certs, subject)
+		}
+	})
+
+	return nil
+}
+
+// FindByCertificateSubject in `certs` map
+func (r *UserRepository) FindByCertificateSubject(ctx context.Context, subject string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, ok := r.certs[subject]
+	if !ok {
+		return nil, store.ErrRecordNotFound
+	}
+
+	c := *r.users[id]
+	return &c, nil
+}
+
+// update emulates optimistic locking of sqlstore: fn changes stored user only if versions match.
+// Email changed by fn must stay unique, otherwise nothing is changed
+func (r *UserRepository) update(u *models.User, fn func(stored *models.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[u.ID]
+	if !ok {
+		return store.ErrRecordNotFound
+	}
+
+	if stored.Version != u.Version {
+		return store.ErrConflict
+	}
+
+	updated := *stored
+	fn(&updated)
+	oldEmail := models.NormalizeEmail(stored.Email)
+	newEmail := models.NormalizeEmail(updated.Email)
+	if newEmail != oldEmail {
+		if _, ok := r.byEmail[newEmail]; ok {
+			return store.ErrDuplicate
+		}
+
+		delete(r.byEmail, oldEmail)
+		r.byEmail[newEmail] = u.ID
+	}
+
+	updated.Version++
+	r.users[u.ID] = &updated
+	u.Version = updated.Version
+	r.store.onRollback(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.users[stored.ID] != &updated {
+			return
+		}
+
+		delete(r.byEmail, newEmail)
+		r.byEmail[oldEmail] = stored.ID
+		r.users[stored.ID] = stored
+	})
+
+	return nil
+}
+
+// List in `users` map sorted by ID like in sqlstore
+func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]*models.User, 0, len(r.users))
+	for _, u := range r.users {
+		users = append(users, u)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return paginate(users, limit, offset), nil
+}
+
+// Search in `users` map by substring of email. There are no indexes here, so ranking is simple:
+// emails starting with query go first, then shorter (closer) ones
+func (r *UserRepository) Search(ctx context.Context, query string, limit, offset int) ([]*models.User, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return []*models.User{}, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := []*models.User{}
+	for _, u := range r.users {
+		if strings.Contains(strings.ToLower(u.Email), query) {
+			users = append(users, u)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		pi := strings.HasPrefix(strings.ToLower(users[i].Email), query)
+		pj := strings.HasPrefix(strings.ToLower(users[j].Email), query)
+		if pi != pj {
+			return pi
+		}
+
+		if len(users[i].Email) != len(users[j].Email) {
+			return len(users[i].Email) < len(users[j].Email)
+		}
+
+		return users[i].ID < users[j].ID
+	})
+
+	return paginate(users, limit, offset), nil
+}
+
+// paginate returns copies of part of already sorted users like LIMIT/OFFSET in SQL
+func paginate(users []*models.User, limit, offset int) []*models.User {
+	if offset >= len(users) {
+		return []*models.User{}
+	}
+
+	users = users[offset:]
+	if limit < len(users) {
+		users = users[:limit]
+	}
+
+	page := make([]*models.User, len(users))
+	for i, u := range users {
+		c := *u
+		page[i] = &c
+	}
+
+	return page
 }
@@ -1,6 +1,7 @@
 package teststore_test
 
 import (
+	"context"
 	"github.com/gopherschool/http-rest-api/internal/app/models"
 	"github.com/gopherschool/http-rest-api/internal/app/store"
 	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
@@ -11,33 +12,133 @@ import (
 
 // tests for Create method
 func TestUserRepository_Create(t *testing.T) {
+	ctx := context.Background()
 	s := teststore.NewStore()
 	u := models.TestUser(t)
 	u.ID = rand.Intn(1000)
-	assert.NoError(t, s.User().Create(u)) // check that no error raised
-	assert.NotNil(t, u)                   // check that user is not nil
+	assert.NoError(t, s.User().Create(ctx, u)) // check that no error raised
+	assert.NotNil(t, u)                        // check that user is not nil
+}
+
+func TestUserRepository_CreateDuplicate(t *testing.T) {
+	ctx := context.Background()
+	s := teststore.NewStore()
+	assert.NoError(t, s.User().Create(ctx, models.TestUser(t)))
+	// same email second time must be rejected by the store
+	assert.ErrorIs(t, s.User().Create(ctx, models.TestUser(t)), store.ErrDuplicate)
 }
 
 func TestUserRepository_FindByEmail(t *testing.T) {
+	ctx := context.Background()
 	s := teststore.NewStore()
 	u1 := models.TestUser(t)
-	_, err := s.User().FindByEmail(u1.Email)
+	_, err := s.User().FindByEmail(ctx, u1.Email)
 	assert.EqualError(t, err, store.ErrRecordNotFound.Error())
 
-	s.User().Create(u1)
-	u2, err := s.User().FindByEmail(u1.Email)
+	s.User().Create(ctx, u1)
+	u2, err := s.User().FindByEmail(ctx, u1.Email)
 	assert.NoError(t, err)
 	assert.NotNil(t, u2)
 }
 
 func TestUserRepository_FindByID(t *testing.T) {
+	ctx := context.Background()
 	s := teststore.NewStore()
 	u1 := models.TestUser(t)
-	_, err := s.User().FindByID(u1.ID)
+	_, err := s.User().FindByID(ctx, u1.ID)
 	assert.EqualError(t, err, store.ErrRecordNotFound.Error())
 
-	s.User().Create(u1)
-	u2, err := s.User().FindByID(u1.ID)
+	s.User().Create(ctx, u1)
+	u2, err := s.User().FindByID(ctx, u1.ID)
 	assert.NoError(t, err)
 	assert.NotNil(t, u2)
 }
+
+func TestUserRepository_FindByEmailCaseInsensitive(t *testing.T) {
+	ctx := context.Background()
+	s := teststore.NewStore()
+	u1 := models.TestUser(t)
+	u1.Email = "User@Example.org"
+	assert.NoError(t, s.User().Create(ctx, u1))
+
+	u2, err := s.User().FindByEmail(ctx, "USER@example.ORG")
+	assert.NoError(t, err)
+	assert.Equal(t, u1.ID, u2.ID)
+
+	// the same email with another case is a duplicate
+	u3 := models.TestUser(t)
+	u3.Email = "user@EXAMPLE.org"
+	assert.ErrorIs(t, s.User().Create(ctx, u3), store.ErrDuplicate)
+}
+
+func TestUserRepository_List(t *testing.T) {
+	ctx := context.Background()
+	s := teststore.NewStore()
+	for _, email := range []string{"first@example.org", "second@example.org", "third@example.org"} {
+		u := models.TestUser(t)
+		u.Email = email
+		assert.NoError(t, s.User().Create(ctx, u))
+	}
+
+	users, err := s.User().List(ctx, 2, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, "second@example.org", users[0].Email)
+		assert.Equal(t, "third@example.org", users[1].Email)
+	}
+
+	users, err = s.User().List(ctx, 2, 3)
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+}
+
+func TestUserRepository_Search(t *testing.T) {
+	ctx := context.Background()
+	s := teststore.NewStore()
+	for _, email := range []string{"john.smith@example.org", "smith@example.org", "other@example.org"} {
+		u := models.TestUser(t)
+		u.Email = email
+		assert.NoError(t, s.User().Create(ctx, u))
+	}
+
+	users, err := s.User().Search(ctx, "SMITH", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, users, 2) {
+		// prefix match goes first
+		assert.Equal(t, "smith@example.org", users[0].Email)
+		assert.Equal(t, "john.smith@example.org", users[1].Email)
+	}
+
+	users, err = s.User().Search(ctx, "smith", 10, 1)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+
+	users, err = s.User().Search(ctx, "nobody", 10, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+}
+
+func TestUserRepository_Update(t *testing.T) {
+	ctx := context.Background()
+	s := teststore.NewStore()
+	u := models.TestUser(t)
+	s.User().Create(ctx, u)
+	other := models.TestUser(t)
+	other.Email = "other@example.org"
+	s.User().Create(ctx, other)
+	stale := *u
+
+	u.Email = "new@example.org"
+	assert.NoError(t, s.User().Update(ctx, u))
+	assert.Equal(t, 2, u.Version)
+
+	// copy loaded before the update can't overwrite it
+	stale.IsAdmin = true
+	assert.ErrorIs(t, s.User().Update(ctx, &stale), store.ErrConflict)
+	assert.ErrorIs(t, s.User().UpdateAvatarURL(ctx, &stale), store.ErrConflict)
+
+	u.Email = other.Email
+	assert.ErrorIs(t, s.User().Update(ctx, u), store.ErrDuplicate)
+
+	assert.ErrorIs(t, s.User().Update(ctx, &models.User{ID: 100}), store.ErrRecordNotFound)
+}
@@ -0,0 +1,25 @@
+package store
+
+// IsolationLevel of transactions started by Store.WithTx
+type IsolationLevel int
+
+const (
+	// IsolationDefault leaves the level to database, it's read committed for postgres
+	IsolationDefault IsolationLevel = iota
+	IsolationReadCommitted
+	IsolationRepeatableRead
+	IsolationSerializable
+)
+
+// DefaultTxMaxRetries is used by WithTx when options are not passed
+const DefaultTxMaxRetries = 3
+
+// TxOptions configure transaction started by Store.WithTx. Nil options mean default isolation
+// and DefaultTxMaxRetries
+type TxOptions struct {
+	Isolation IsolationLevel
+	ReadOnly  bool
+	// MaxRetries is how many times fn is run again after serialization failure or deadlock.
+	// fn must be safe to repeat, i.e. it must not have side effects outside of the store
+	MaxRetries int
+}
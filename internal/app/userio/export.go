@@ -0,0 +1,42 @@
+package userio
+
+import (
+	"context"
+
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// Export writes all users from the store to w page by page and returns the number of exported users.
+// Only password hashes are exported, they can be imported back as pre-hashed passwords.
+// Erased users have neither email nor password, they are skipped
+func Export(ctx context.Context, s store.Store, w RecordWriter, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	exported := 0
+	for offset := 0; ; offset += batchSize {
+		users, err := s.User().List(ctx, batchSize, offset)
+		if err != nil {
+			return exported, err
+		}
+
+		for _, u := range users {
+			if u.IsErased() {
+				continue
+			}
+
+			if err := w.Write(&Record{Email: u.Email, EncryptedPassword: u.EncryptedPassword}); err != nil {
+				return exported, err
+			}
+
+			exported++
+		}
+
+		if len(users) < batchSize {
+			break
+		}
+	}
+
+	return exported, w.Flush()
+}
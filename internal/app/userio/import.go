@@ -0,0 +1,163 @@
+package userio
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+)
+
+// DefaultBatchSize is the number of users inserted in one transaction if nothing else is configured
+const DefaultBatchSize = 500
+
+// RowError describes why one row of the input wasn't imported. Row numbers start with 1
+type RowError struct {
+	Row   int
+	Email string
+	Err   error
+}
+
+// Report is the result of import
+type Report struct {
+	Imported int
+	Failed   []RowError
+}
+
+// ImportOptions ...
+type ImportOptions struct {
+	BatchSize int
+}
+
+// pendingRow is a valid user waiting for its batch to be inserted
+type pendingRow struct {
+	row  int
+	user *models.User
+}
+
+// Import reads users from r, validates every row and inserts valid ones in batches,
+// every batch in its own transaction. Rows which can't be imported are listed in the report.
+// Error is returned only if the import can't continue at all (e.g. input can't be read)
+func Import(ctx context.Context, s store.Store, r RecordReader, opts ImportOptions) (*Report, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	report := &Report{}
+	batch := make([]pendingRow, 0, opts.BatchSize)
+	for row := 1; ; row++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			var malformed *malformedRowError
+			if !errors.As(err, &malformed) {
+				return report, err
+			}
+
+			report.Failed = append(report.Failed, RowError{Row: row, Err: err})
+			continue
+		}
+
+		u := &models.User{
+			Email:             rec.Email,
+			Password:          rec.Password,
+			EncryptedPassword: rec.EncryptedPassword,
+		}
+
+		// invalid rows are reported right away and don't break the batch
+		if err := validateRecord(u); err != nil {
+			report.Failed = append(report.Failed, RowError{Row: row, Email: rec.Email, Err: err})
+			continue
+		}
+
+		batch = append(batch, pendingRow{row: row, user: u})
+		if len(batch) == opts.BatchSize {
+			importBatch(ctx, s, batch, report)
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		importBatch(ctx, s, batch, report)
+	}
+
+	// rows skipped inside of batches are reported later than invalid ones
+	sort.SliceStable(report.Failed, func(i, j int) bool { return report.Failed[i].Row < report.Failed[j].Row })
+	return report, nil
+}
+
+// validateRecord validates user and its pre-hashed password: users with hashes nobody can log in with are not imported
+func validateRecord(u *models.User) error {
+	if err := u.Validate(); err != nil {
+		return err
+	}
+
+	if u.EncryptedPassword != "" {
+		return models.ValidatePasswordHash(u.EncryptedPassword)
+	}
+
+	return nil
+}
+
+// WriteReport writes failed rows as CSV: row,email,error
+func WriteReport(w io.Writer, report *Report) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"row", "email", "error"}); err != nil {
+		return err
+	}
+
+	for _, f := range report.Failed {
+		if err := cw.Write([]string{strconv.Itoa(f.Row), f.Email, f.Err.Error()}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// importBatch inserts all users of the batch in one transaction. Users which already exist are skipped,
+// any other error rolls back the whole batch and all its rows are reported as failed
+func importBatch(ctx context.Context, s store.Store, batch []pendingRow, report *Report) {
+	var skipped []RowError
+	imported := 0
+	err := s.WithTx(ctx, nil, func(tx store.Store) error {
+		// transaction may be retried, so counters start from scratch every time
+		skipped, imported = nil, 0
+		for _, p := range batch {
+			// check duplicates before insert: in postgres any failed statement aborts the whole transaction
+			if _, err := tx.User().FindByEmail(ctx, p.user.Email); err == nil {
+				skipped = append(skipped, RowError{Row: p.row, Email: p.user.Email, Err: store.ErrDuplicate})
+				continue
+			} else if err != store.ErrRecordNotFound {
+				return err
+			}
+
+			if err := tx.User().Create(ctx, p.user); err != nil {
+				return err
+			}
+
+			imported++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		for _, p := range batch {
+			report.Failed = append(report.Failed, RowError{Row: p.row, Email: p.user.Email, Err: err})
+		}
+
+		return
+	}
+
+	report.Imported += imported
+	report.Failed = append(report.Failed, skipped...)
+}
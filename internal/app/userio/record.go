@@ -0,0 +1,194 @@
+package userio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Supported file formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson" // one JSON object per line
+)
+
+// CSV header columns. Order doesn't matter for import, only email is required
+const (
+	columnEmail             = "email"
+	columnPassword          = "password"
+	columnEncryptedPassword = "encrypted_password"
+)
+
+var errUnknownFormat = errors.New("unknown format")
+
+// malformedRowError is returned by readers when one row can't be parsed, but the next ones still can
+type malformedRowError struct {
+	err error
+}
+
+func (e *malformedRowError) Error() string {
+	return "malformed row: " + e.err.Error()
+}
+
+func (e *malformedRowError) Unwrap() error {
+	return e.err
+}
+
+// Record is one user in import/export file.
+// Either Password (plain text, will be hashed) or EncryptedPassword (already hashed) should be set
+type Record struct {
+	Email             string `json:"email"`
+	Password          string `json:"password,omitempty"`
+	EncryptedPassword string `json:"encrypted_password,omitempty"`
+}
+
+// RecordReader reads records one by one and returns io.EOF when there are no more records
+type RecordReader interface {
+	Read() (*Record, error)
+}
+
+// RecordWriter writes records, Flush must be called at the end
+type RecordWriter interface {
+	Write(*Record) error
+	Flush() error
+}
+
+// NewReader returns reader for the given format
+func NewReader(r io.Reader, format string) (RecordReader, error) {
+	switch format {
+	case FormatCSV:
+		return &csvReader{r: csv.NewReader(r)}, nil
+	case FormatNDJSON:
+		return &ndjsonReader{s: bufio.NewScanner(r)}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", errUnknownFormat, format)
+}
+
+// NewWriter returns writer for the given format
+func NewWriter(w io.Writer, format string) (RecordWriter, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case FormatNDJSON:
+		bw := bufio.NewWriter(w)
+		return &ndjsonWriter{w: bw, enc: json.NewEncoder(bw)}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", errUnknownFormat, format)
+}
+
+// csvReader maps columns by the header row, so files may have extra columns we don't care about
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func (r *csvReader) Read() (*Record, error) {
+	if r.columns == nil {
+		header, err := r.r.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		r.columns = make(map[string]int, len(header))
+		for i, name := range header {
+			r.columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+
+		if _, ok := r.columns[columnEmail]; !ok {
+			return nil, fmt.Errorf("csv header doesn't have %q column", columnEmail)
+		}
+	}
+
+	row, err := r.r.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, &malformedRowError{err: err}
+		}
+
+		return nil, err
+	}
+
+	return &Record{
+		Email:             r.column(row, columnEmail),
+		Password:          r.column(row, columnPassword),
+		EncryptedPassword: r.column(row, columnEncryptedPassword),
+	}, nil
+}
+
+func (r *csvReader) column(row []string, name string) string {
+	i, ok := r.columns[name]
+	if !ok || i >= len(row) {
+		return ""
+	}
+
+	return row[i]
+}
+
+type csvWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (w *csvWriter) Write(rec *Record) error {
+	if !w.headerWritten {
+		if err := w.w.Write([]string{columnEmail, columnEncryptedPassword}); err != nil {
+			return err
+		}
+
+		w.headerWritten = true
+	}
+
+	return w.w.Write([]string{rec.Email, rec.EncryptedPassword})
+}
+
+func (w *csvWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type ndjsonReader struct {
+	s *bufio.Scanner
+}
+
+func (r *ndjsonReader) Read() (*Record, error) {
+	for r.s.Scan() {
+		line := strings.TrimSpace(r.s.Text())
+		// skip empty lines, e.g. at the end of file
+		if line == "" {
+			continue
+		}
+
+		rec := &Record{}
+		if err := json.Unmarshal([]byte(line), rec); err != nil {
+			return nil, &malformedRowError{err: err}
+		}
+
+		return rec, nil
+	}
+
+	if err := r.s.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+type ndjsonWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(rec *Record) error {
+	return w.enc.Encode(rec) // Encode adds new line after every object
+}
+
+func (w *ndjsonWriter) Flush() error {
+	return w.w.Flush()
+}
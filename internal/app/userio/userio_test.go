@@ -0,0 +1,110 @@
+package userio_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherschool/http-rest-api/internal/app/models"
+	"github.com/gopherschool/http-rest-api/internal/app/store"
+	"github.com/gopherschool/http-rest-api/internal/app/store/teststore"
+	"github.com/gopherschool/http-rest-api/internal/app/userio"
+)
+
+func TestImport_CSV(t *testing.T) {
+	ctx := context.Background()
+	s := teststore.NewStore()
+	existing := models.TestUser(t)
+	assert.NoError(t, s.User().Create(ctx, existing))
+
+	input := strings.Join([]string{
+		"email,password,encrypted_password",
+		"new@example.org,password,",
+		"invalid,password,",
+		existing.Email + ",password,",
+		"hashed@example.org,," + existing.EncryptedPassword,
+		"too,many,columns,here",
+		"malformed@example.org,,$2a$04$abcdefghijklmnopqrstuu",
+	}, "\n")
+
+	r, err := userio.NewReader(strings.NewReader(input), userio.FormatCSV)
+	assert.NoError(t, err)
+
+	report, err := userio.Import(ctx, s, r, userio.ImportOptions{BatchSize: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Imported)
+	if assert.Len(t, report.Failed, 4) {
+		assert.Equal(t, 2, report.Failed[0].Row) // invalid email
+		assert.Equal(t, 3, report.Failed[1].Row) // duplicate
+		assert.ErrorIs(t, report.Failed[1].Err, store.ErrDuplicate)
+		assert.Equal(t, 5, report.Failed[2].Row) // malformed
+		assert.Equal(t, 6, report.Failed[3].Row) // malformed hash
+		assert.ErrorIs(t, report.Failed[3].Err, models.ErrInvalidPasswordHash)
+	}
+
+	// pre-hashed password is stored as is
+	u, err := s.User().FindByEmail(ctx, "hashed@example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, existing.EncryptedPassword, u.EncryptedPassword)
+	assert.True(t, u.ComparePasswords("password"))
+
+	b := &bytes.Buffer{}
+	assert.NoError(t, userio.WriteReport(b, report))
+	assert.Contains(t, b.String(), "row,email,error\n")
+}
+
+func TestImport_NDJSON(t *testing.T) {
+	s := teststore.NewStore()
+	input := `{"email":"first@example.org","password":"password"}
+
+{"email":"second@example.org","password":"password"}
+not json
+`
+	r, err := userio.NewReader(strings.NewReader(input), userio.FormatNDJSON)
+	assert.NoError(t, err)
+
+	report, err := userio.Import(context.Background(), s, r, userio.ImportOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Imported)
+	assert.Len(t, report.Failed, 1)
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	s := teststore.NewStore()
+	for _, email := range []string{"first@example.org", "second@example.org", "third@example.org"} {
+		u := models.TestUser(t)
+		u.Email = email
+		assert.NoError(t, s.User().Create(ctx, u))
+	}
+
+	erased := models.TestUser(t)
+	erased.Email = "erased@example.org"
+	assert.NoError(t, s.User().Create(ctx, erased))
+	assert.NoError(t, s.User().Anonymize(ctx, erased))
+
+	b := &bytes.Buffer{}
+	w, err := userio.NewWriter(b, userio.FormatNDJSON)
+	assert.NoError(t, err)
+
+	n, err := userio.Export(ctx, s, w, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	// exported file can be imported into another store as is
+	r, err := userio.NewReader(b, userio.FormatNDJSON)
+	assert.NoError(t, err)
+
+	report, err := userio.Import(ctx, teststore.NewStore(), r, userio.ImportOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Imported)
+	assert.Empty(t, report.Failed)
+}
+
+func TestNewReader_UnknownFormat(t *testing.T) {
+	_, err := userio.NewReader(strings.NewReader(""), "xml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,5 @@
+CREATE TABLE users (
+    id bigserial NOT NULL PRIMARY KEY,
+    email varchar NOT NULL UNIQUE,
+    encrypted_password varchar NOT NULL
+);
@@ -0,0 +1,4 @@
+-- emails are compared case-insensitively, so uniqueness must be checked on lower(email).
+-- if this migration fails, there are accounts which differ only by case and must be merged by hand
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+CREATE UNIQUE INDEX users_email_lower_idx ON users (lower(email));
@@ -0,0 +1,5 @@
+-- settings chosen when the database is first used, e.g. email_provider_rules, see apiserver.checkSettings
+CREATE TABLE settings (
+    name varchar NOT NULL PRIMARY KEY,
+    value varchar NOT NULL
+);
@@ -0,0 +1,4 @@
+-- see searchUsers in internal/app/store/sqlstore/dialect.go
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX users_email_trgm_idx ON users USING gin (lower(email) gin_trgm_ops);
+CREATE INDEX users_email_fts_idx ON users USING gin (to_tsvector('simple', translate(lower(email), '@.+_-', '     ')));
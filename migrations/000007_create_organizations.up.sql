@@ -0,0 +1,13 @@
+CREATE TABLE organizations (
+    id bigserial NOT NULL PRIMARY KEY,
+    name varchar NOT NULL
+);
+
+CREATE TABLE memberships (
+    organization_id bigint NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role varchar NOT NULL,
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX memberships_user_id_idx ON memberships (user_id);
@@ -0,0 +1,11 @@
+CREATE TABLE invitations (
+    id bigserial NOT NULL PRIMARY KEY,
+    organization_id bigint NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    email varchar NOT NULL,
+    role varchar NOT NULL,
+    invited_by bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at timestamptz NOT NULL,
+    accepted_at timestamptz
+);
+
+CREATE INDEX invitations_organization_id_idx ON invitations (organization_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS invitations_email_idx;
+DROP TABLE data_exports;
+ALTER TABLE users DROP COLUMN erased_at;
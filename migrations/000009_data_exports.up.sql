@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN erased_at timestamptz;
+
+CREATE TABLE data_exports (
+    id bigserial NOT NULL PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    status varchar NOT NULL,
+    blob_key varchar NOT NULL DEFAULT '',
+    error varchar NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT now(),
+    completed_at timestamptz
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports (user_id);
+CREATE INDEX invitations_email_idx ON invitations (email);
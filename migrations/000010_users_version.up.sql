@@ -0,0 +1,2 @@
+-- incremented by every update, see optimistic locking in UserRepository
+ALTER TABLE users ADD COLUMN version integer NOT NULL DEFAULT 1;
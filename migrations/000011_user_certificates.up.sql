@@ -0,0 +1,10 @@
+-- subjects and SANs of client certificates which authenticate as user, see authenticateUser.
+-- Every name starts with its type, see models.CertificateDN and others
+CREATE TABLE user_certificates (
+    subject varchar NOT NULL PRIMARY KEY CHECK (
+        subject LIKE 'dn:%' OR subject LIKE 'dns:%' OR subject LIKE 'email:%' OR subject LIKE 'uri:%'
+    ),
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX user_certificates_user_id_idx ON user_certificates (user_id);
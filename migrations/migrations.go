@@ -0,0 +1,10 @@
+// Package migrations contains postgres schema as versioned SQL files.
+// Files are embedded into the binary, see `apiserver migrate`
+package migrations
+
+import "embed"
+
+// FS contains files like 000001_create_users.up.sql and 000001_create_users.down.sql
+//
+//go:embed *.sql
+var FS embed.FS